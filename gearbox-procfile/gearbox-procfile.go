@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/net/context"
+
+	"github.com/albertrdixon/gearbox/logger"
+	"github.com/albertrdixon/gearbox/process"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	version = "v0.0.1"
+	colors  = []int{36, 33, 32, 35, 34, 31}
+
+	app         = kingpin.New("gearbox-procfile", "Run the processes in a Procfile.")
+	logLevel    = app.Flag("log-level", "Log level.").Short('l').PlaceHolder("{debug,info,warn,error,fatal}").Default("info").Enum(logger.Levels...)
+	procfile    = app.Flag("procfile", "Procfile to run.").Short('f').Default("Procfile").String()
+	envFile     = app.Flag("env", "Env file to load if present.").Short('e').Default(".env").String()
+	concurrency = app.Flag("concurrency", "Processes to run per type, e.g. web=2,worker=0. Default: 1 each").Short('c').Strings()
+	port        = app.Flag("port", "Base PORT. Each type gets the next 100 and each process the next port within it.").Short('p').Default("5000").Int()
+	timeout     = app.Flag("timeout", "Time processes are given to stop after SIGTERM.").Short('t').Default("10s").Duration()
+)
+
+func formatter(width, color int, tty bool) process.Formatter {
+	return func(name string, l process.Line) string {
+		prefix := fmt.Sprintf("%s %-*s |", l.Time.Format("15:04:05"), width, name)
+		if tty {
+			prefix = fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, prefix)
+		}
+		return prefix + " " + l.Text
+	}
+}
+
+func buildProcs(types []procType, counts map[string]int, env *process.Env) ([]*process.Process, error) {
+	width := 0
+	for _, t := range types {
+		for i := 1; i <= counts[t.Name]; i++ {
+			if n := len(fmt.Sprintf("%s.%d", t.Name, i)); n > width {
+				width = n
+			}
+		}
+	}
+
+	var (
+		procs []*process.Process
+		tty   = terminal.IsTerminal(int(os.Stdout.Fd()))
+	)
+	for ti, t := range types {
+		for i := 1; i <= counts[t.Name]; i++ {
+			name := fmt.Sprintf("%s.%d", t.Name, i)
+			p, er := process.NewArgv(name, []string{"sh", "-c", t.Cmd}, os.Stdout)
+			if er != nil {
+				return nil, er
+			}
+			env.Set("PORT", strconv.Itoa(*port+100*ti+i-1))
+			p.SetEnvironment(env).
+				SetProcessGroup().
+				SetStopSignal(syscall.SIGTERM, *timeout).
+				SetFormatter(formatter(width, colors[len(procs)%len(colors)], tty))
+			procs = append(procs, p)
+		}
+	}
+	return procs, nil
+}
+
+// run starts procs and, as soon as one of them exits or we are signalled,
+// stops the rest. It returns the exit status of the first to exit, or
+// 128 plus the signal number when signalled.
+func run(procs []*process.Process) int {
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Children run in their own process groups and do not see a Ctrl-C,
+	// so the handler must be in place before the first of them starts.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	exited := make(chan *process.Process, len(procs))
+	for _, p := range procs {
+		select {
+		case sig := <-sigs:
+			return stop(procs, cancel, sig)
+		default:
+		}
+		if er := p.Execute(c); er != nil {
+			logger.Errorf("could not start %s: %v", p, er)
+			cancel()
+			wait(procs)
+			return 1
+		}
+		logger.Infof("started %s", p)
+		go func(p *process.Process) {
+			<-p.Exited()
+			exited <- p
+		}(p)
+	}
+
+	select {
+	case p := <-exited:
+		logger.Infof("%s exited (%v), stopping all processes", p, p.Result())
+		cancel()
+		wait(procs)
+		return p.Result().Status()
+	case sig := <-sigs:
+		return stop(procs, cancel, sig)
+	}
+}
+
+func stop(procs []*process.Process, cancel context.CancelFunc, sig os.Signal) int {
+	logger.Infof("received %v, stopping all processes", sig)
+	cancel()
+	wait(procs)
+	return 128 + int(sig.(syscall.Signal))
+}
+
+func wait(procs []*process.Process) {
+	deadline := time.After(*timeout + 5*time.Second)
+	for _, p := range procs {
+		select {
+		case <-p.Exited():
+		case <-deadline:
+			logger.Warnf("%s did not exit", p)
+		}
+	}
+}
+
+func main() {
+	app.Version(version)
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+	logger.Configure(*logLevel, "[gearbox-procfile] ", os.Stdout)
+
+	f, er := os.Open(*procfile)
+	if er != nil {
+		logger.Fatalf("%v", er)
+	}
+	types, er := parseProcfile(f)
+	f.Close()
+	if er != nil {
+		logger.Fatalf("%v", er)
+	}
+	counts, er := parseConcurrency(types, *concurrency)
+	if er != nil {
+		logger.Fatalf("%v", er)
+	}
+
+	env := process.NewEnv().Inherit()
+	if _, er := os.Stat(*envFile); er == nil {
+		if er := env.LoadFileExpanded(*envFile); er != nil {
+			logger.Fatalf("%v", er)
+		}
+	}
+
+	procs, er := buildProcs(types, counts, env)
+	if er != nil {
+		logger.Fatalf("%v", er)
+	}
+	if len(procs) < 1 {
+		logger.Fatalf("no processes to run")
+	}
+	os.Exit(run(procs))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var procLine = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+type procType struct {
+	Name, Cmd string
+}
+
+// parseProcfile reads "name: command" lines. Blank lines and comments are
+// skipped.
+func parseProcfile(r io.Reader) ([]procType, error) {
+	var (
+		types []procType
+		seen  = make(map[string]bool)
+		s     = bufio.NewScanner(r)
+		n     int
+	)
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := procLine.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("Procfile:%d: expected \"name: command\"", n)
+		}
+		if seen[m[1]] {
+			return nil, fmt.Errorf("Procfile:%d: duplicate process type %q", n, m[1])
+		}
+		seen[m[1]] = true
+		types = append(types, procType{Name: m[1], Cmd: m[2]})
+	}
+	if er := s.Err(); er != nil {
+		return nil, er
+	}
+	if len(types) < 1 {
+		return nil, fmt.Errorf("Procfile has no process types")
+	}
+	return types, nil
+}
+
+// parseConcurrency reads specs like "web=2,worker=0", given once or
+// repeated. Every type defaults to 1.
+func parseConcurrency(types []procType, specs []string) (map[string]int, error) {
+	counts := make(map[string]int, len(types))
+	for _, t := range types {
+		counts[t.Name] = 1
+	}
+	for _, spec := range specs {
+		for _, kv := range strings.Split(spec, ",") {
+			kv = strings.TrimSpace(kv)
+			if kv == "" {
+				continue
+			}
+			i := strings.Index(kv, "=")
+			if i < 1 {
+				return nil, fmt.Errorf("bad concurrency %q, expected name=count", kv)
+			}
+			name := kv[:i]
+			if _, ok := counts[name]; !ok {
+				return nil, fmt.Errorf("unknown process type %q", name)
+			}
+			n, er := strconv.Atoi(kv[i+1:])
+			if er != nil || n < 0 {
+				return nil, fmt.Errorf("bad concurrency %q, expected name=count", kv)
+			}
+			counts[name] = n
+		}
+	}
+	return counts, nil
+}
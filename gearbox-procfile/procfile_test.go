@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProcfile(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run      int
+		procfile string
+		expected []procType
+		err      bool
+	}{
+		{1, "web: bundle exec rails s -p $PORT\nworker: rake jobs:work\n", []procType{
+			{"web", "bundle exec rails s -p $PORT"},
+			{"worker", "rake jobs:work"},
+		}, false},
+		{2, "# comment\n\nclock:   ./clock  \n", []procType{{"clock", "./clock"}}, false},
+		{3, "web bundle exec rails s\n", nil, true},
+		{4, "web: a\nweb: b\n", nil, true},
+		{5, "\n# nothing\n", nil, true},
+	}
+
+	for _, test := range tests {
+		types, er := parseProcfile(strings.NewReader(test.procfile))
+		if test.err {
+			is.Error(er, "test %d", test.run)
+			continue
+		}
+		is.NoError(er, "test %d", test.run)
+		is.Equal(test.expected, types, "test %d", test.run)
+	}
+}
+
+func TestParseConcurrency(t *testing.T) {
+	is := assert.New(t)
+	types := []procType{{"web", "a"}, {"worker", "b"}}
+	var tests = []struct {
+		run      int
+		specs    []string
+		expected map[string]int
+		err      bool
+	}{
+		{1, nil, map[string]int{"web": 1, "worker": 1}, false},
+		{2, []string{"web=3,worker=0"}, map[string]int{"web": 3, "worker": 0}, false},
+		{3, []string{"web=2", "worker=4"}, map[string]int{"web": 2, "worker": 4}, false},
+		{4, []string{"clock=1"}, nil, true},
+		{5, []string{"web=-1"}, nil, true},
+		{6, []string{"web"}, nil, true},
+	}
+
+	for _, test := range tests {
+		counts, er := parseConcurrency(types, test.specs)
+		if test.err {
+			is.Error(er, "test %d", test.run)
+			continue
+		}
+		is.NoError(er, "test %d", test.run)
+		is.Equal(test.expected, counts, "test %d", test.run)
+	}
+}
@@ -0,0 +1,178 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	cgroupRoot = "/sys/fs/cgroup"
+	cgroupSeq  uint64
+)
+
+// Cgroup places a process in a new cgroup v2 group with the given limits.
+// Parent is the delegated cgroup directory to create the group in and
+// defaults to the cgroup of the current process. Zero limits are left
+// unset.
+type Cgroup struct {
+	Parent    string
+	Name      string
+	MemoryMax int64
+	CPUQuota  time.Duration
+	CPUPeriod time.Duration
+	PidsMax   int
+}
+
+// SetCgroup runs the process in its own cgroup v2 group, which it is
+// started directly into. When the group cannot be created, e.g. because
+// the caller has no delegated cgroup, the process runs without it and a
+// warning is logged. Before Linux 5.7 a process cannot be started into a
+// group, so it is moved there just after it starts instead.
+func (p *Process) SetCgroup(cg Cgroup) *Process {
+	p.cgroup = &cg
+	return p
+}
+
+type cgroupRun struct {
+	path string
+	dir  *os.File
+}
+
+func (cg *Cgroup) controllers() []string {
+	var c []string
+	if cg.MemoryMax > 0 {
+		c = append(c, "memory")
+	}
+	if cg.CPUQuota > 0 {
+		c = append(c, "cpu")
+	}
+	if cg.PidsMax > 0 {
+		c = append(c, "pids")
+	}
+	return c
+}
+
+func (cg *Cgroup) files() map[string]string {
+	files := make(map[string]string)
+	if cg.MemoryMax > 0 {
+		files["memory.max"] = strconv.FormatInt(cg.MemoryMax, 10)
+	}
+	if cg.CPUQuota > 0 {
+		period := cg.CPUPeriod
+		if period <= 0 {
+			period = 100 * time.Millisecond
+		}
+		files["cpu.max"] = fmt.Sprintf("%d %d", cg.CPUQuota/time.Microsecond, period/time.Microsecond)
+	}
+	if cg.PidsMax > 0 {
+		files["pids.max"] = strconv.Itoa(cg.PidsMax)
+	}
+	return files
+}
+
+func createCgroup(cg *Cgroup, name string) (*cgroupRun, error) {
+	if _, er := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); er != nil {
+		return nil, fmt.Errorf("cgroup v2 is not mounted at %s", cgroupRoot)
+	}
+
+	parent := cg.Parent
+	if parent == "" {
+		own, er := ownCgroup()
+		if er != nil {
+			return nil, er
+		}
+		parent = filepath.Join(cgroupRoot, own)
+	}
+	if cg.Name != "" {
+		name = cg.Name
+	} else {
+		name = fmt.Sprintf("%s-%d-%d", name, os.Getpid(), atomic.AddUint64(&cgroupSeq, 1))
+	}
+
+	if c := cg.controllers(); len(c) > 0 {
+		enable := "+" + strings.Join(c, " +")
+		// This fails if the controllers are already enabled or the parent
+		// still has processes of its own; missing controller files below
+		// are the real error.
+		ioutil.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte(enable), 0644)
+	}
+
+	g := &cgroupRun{path: filepath.Join(parent, name)}
+	if er := os.Mkdir(g.path, 0755); er != nil {
+		return nil, er
+	}
+	for file, value := range cg.files() {
+		if er := ioutil.WriteFile(filepath.Join(g.path, file), []byte(value), 0644); er != nil {
+			g.remove()
+			return nil, er
+		}
+	}
+	dir, er := os.Open(g.path)
+	if er != nil {
+		g.remove()
+		return nil, er
+	}
+	g.dir = dir
+	return g, nil
+}
+
+// ownCgroup returns the cgroup v2 path of the current process relative to
+// the cgroup mount.
+func ownCgroup() (string, error) {
+	b, er := ioutil.ReadFile(filepath.Join(procRoot, "self", "cgroup"))
+	if er != nil {
+		return "", er
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 entry in /proc/self/cgroup")
+}
+
+// add moves pid into the group, for a child that could not be started in
+// it.
+func (g *cgroupRun) add(pid int) error {
+	return ioutil.WriteFile(filepath.Join(g.path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+func (g *cgroupRun) oomKilled() bool {
+	b, er := ioutil.ReadFile(filepath.Join(g.path, "memory.events"))
+	if er != nil {
+		return false
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) == 2 && f[0] == "oom_kill" {
+			n, _ := strconv.Atoi(f[1])
+			return n > 0
+		}
+	}
+	return false
+}
+
+// remove deletes the group, retrying briefly while any remaining members
+// finish exiting.
+func (g *cgroupRun) remove() error {
+	if g.dir != nil {
+		g.dir.Close()
+	}
+	var er error
+	for i := 0; i < 10; i++ {
+		if er = os.Remove(g.path); er == nil || os.IsNotExist(er) {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return er
+}
@@ -0,0 +1,39 @@
+package process
+
+import (
+	"errors"
+	"sync/atomic"
+	"syscall"
+)
+
+// noCloneIntoCgroup is set once the kernel is found to lack
+// CLONE_INTO_CGROUP, which needs Linux 5.7 or later.
+var noCloneIntoCgroup int32
+
+// useCgroup starts the child directly in g with CLONE_INTO_CGROUP, unless
+// the kernel is known not to support it. It reports whether it will.
+func useCgroup(attr *syscall.SysProcAttr, g *cgroupRun) bool {
+	if atomic.LoadInt32(&noCloneIntoCgroup) != 0 {
+		return false
+	}
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(g.dir.Fd())
+	return true
+}
+
+// cloneUnsupported reports whether er, from starting a child with
+// useCgroup, means the kernel lacks CLONE_INTO_CGROUP: clone3 is missing
+// before 5.3, and rejects the cgroup argument before 5.7. useCgroup does
+// not try again once it has.
+func cloneUnsupported(er error) bool {
+	if !errors.Is(er, syscall.ENOSYS) && !errors.Is(er, syscall.E2BIG) && !errors.Is(er, syscall.EINVAL) {
+		return false
+	}
+	atomic.StoreInt32(&noCloneIntoCgroup, 1)
+	return true
+}
+
+func dropCgroup(attr *syscall.SysProcAttr) {
+	attr.UseCgroupFD = false
+	attr.CgroupFD = 0
+}
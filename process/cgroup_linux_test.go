@@ -0,0 +1,127 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// delegatedCgroup points cgroupRoot at the cgroup v2 mount and skips the
+// test unless a group with the given controllers can be created there. The
+// returned func restores cgroupRoot.
+func delegatedCgroup(t *testing.T, controllers ...string) func() {
+	f, er := os.Open(filepath.Join(procRoot, "self", "mounts"))
+	if er != nil {
+		t.Skip(er)
+	}
+	defer f.Close()
+	root := ""
+	for s := bufio.NewScanner(f); s.Scan(); {
+		if fields := strings.Fields(s.Text()); len(fields) > 2 && fields[2] == "cgroup2" {
+			root = fields[1]
+			break
+		}
+	}
+	if root == "" {
+		t.Skip("cgroup v2 is not mounted")
+	}
+
+	orig := cgroupRoot
+	restore := func() { cgroupRoot = orig }
+	cgroupRoot = root
+	g, er := createCgroup(&Cgroup{}, "probe")
+	if er != nil {
+		restore()
+		t.Skipf("no delegated cgroup: %v", er)
+	}
+	defer g.remove()
+	b, _ := ioutil.ReadFile(filepath.Join(filepath.Dir(g.path), "cgroup.controllers"))
+	have := strings.Fields(string(b))
+	for _, c := range controllers {
+		if !contains(have, c) {
+			restore()
+			t.Skipf("%s controller is not available", c)
+		}
+	}
+	return restore
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCgroup(t *testing.T) {
+	is := assert.New(t)
+	defer delegatedCgroup(t)()
+	defer atomic.StoreInt32(&noCloneIntoCgroup, atomic.LoadInt32(&noCloneIntoCgroup))
+
+	// Without CLONE_INTO_CGROUP the process is moved into its group just
+	// after it starts.
+	for i, clone := range []bool{true, false} {
+		atomic.StoreInt32(&noCloneIntoCgroup, 0)
+		if !clone {
+			atomic.StoreInt32(&noCloneIntoCgroup, 1)
+		}
+		var out bytes.Buffer
+		name := fmt.Sprintf("gearbox-test-%d-%d", os.Getpid(), i)
+		p, er := New("cgroup", "sh -c 'sleep 0.1; cat /proc/self/cgroup'", &out)
+		is.NoError(er)
+		p.RawOutput().SetCgroup(Cgroup{Name: name})
+
+		is.NoError(p.Execute(context.Background()), "clone=%v", clone)
+		<-p.Exited()
+		is.NoError(p.Error(), "clone=%v", clone)
+		is.Contains(out.String(), "/"+name+"\n", "clone=%v", clone)
+		is.False(p.Result().OOMKilled, "clone=%v", clone)
+	}
+}
+
+func TestCloneUnsupported(t *testing.T) {
+	is := assert.New(t)
+	defer atomic.StoreInt32(&noCloneIntoCgroup, atomic.LoadInt32(&noCloneIntoCgroup))
+	var tests = []struct {
+		run         int
+		er          error
+		unsupported bool
+	}{
+		{1, &os.PathError{Op: "fork/exec", Path: "/bin/true", Err: syscall.ENOSYS}, true},
+		{2, &os.PathError{Op: "fork/exec", Path: "/bin/true", Err: syscall.E2BIG}, true},
+		{3, &os.PathError{Op: "fork/exec", Path: "/bin/true", Err: syscall.ENOENT}, false},
+		{4, &os.PathError{Op: "fork/exec", Path: "/bin/true", Err: syscall.EBADF}, false},
+	}
+	for _, test := range tests {
+		atomic.StoreInt32(&noCloneIntoCgroup, 0)
+		is.Equal(test.unsupported, cloneUnsupported(test.er), "test %d", test.run)
+		is.Equal(test.unsupported, !useCgroup(&syscall.SysProcAttr{}, &cgroupRun{dir: os.Stdin}), "test %d", test.run)
+	}
+}
+
+func TestCgroupOOM(t *testing.T) {
+	is := assert.New(t)
+	defer delegatedCgroup(t, "memory")()
+
+	p, er := New("oom", "tail /dev/zero")
+	is.NoError(er)
+	p.SetCgroup(Cgroup{MemoryMax: 16 << 20})
+
+	is.NoError(p.Execute(context.Background()))
+	<-p.Exited()
+	r := p.Result()
+	is.True(r.OOMKilled)
+	is.Equal(syscall.SIGKILL, r.Signal)
+}
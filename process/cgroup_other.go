@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import "syscall"
+
+func useCgroup(attr *syscall.SysProcAttr, g *cgroupRun) bool {
+	return false
+}
+
+func cloneUnsupported(er error) bool {
+	return false
+}
+
+func dropCgroup(attr *syscall.SysProcAttr) {}
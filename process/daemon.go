@@ -0,0 +1,252 @@
+package process
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrNotRunning = errors.New("process is not running")
+
+// DaemonConfig describes how Daemonize detaches a process. Stdout and
+// Stderr are appended to, and default to /dev/null, as does Stdin.
+type DaemonConfig struct {
+	Pidfile string
+	Stdin   string
+	Stdout  string
+	Stderr  string
+}
+
+// Daemonize starts the process detached in a new session with its stdio
+// redirected to files, records it in dc.Pidfile and returns its pid. Only
+// the process's directory, environment, user and rlimits apply; it is not
+// otherwise managed. It fails if the pidfile names a process that is still
+// running, and replaces it if it is stale. Concurrent calls for the same
+// pidfile are serialised by an flock on the pidfile's name plus ".lock",
+// which is left in place.
+func (p *Process) Daemonize(dc DaemonConfig) (int, error) {
+	if dc.Pidfile != "" {
+		unlock, er := lockPidfile(dc.Pidfile)
+		if er != nil {
+			return 0, er
+		}
+		defer unlock()
+		if pid, er := CheckPidfile(dc.Pidfile); er == nil {
+			return 0, fmt.Errorf("%s is already running with pid %d", p.name, pid)
+		} else if er != ErrNotRunning {
+			return 0, er
+		}
+	}
+
+	cmd, er := p.command()
+	if er != nil {
+		return 0, er
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setpgid = false
+	cmd.SysProcAttr.Setctty = false
+
+	files := make([]*os.File, 0, 3)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	open := func(path string, flag int) (*os.File, error) {
+		if path == "" {
+			path = os.DevNull
+		}
+		f, er := os.OpenFile(path, flag, 0644)
+		if er != nil {
+			return nil, er
+		}
+		files = append(files, f)
+		return f, nil
+	}
+	if cmd.Stdin, er = open(dc.Stdin, os.O_RDONLY); er != nil {
+		return 0, er
+	}
+	if cmd.Stdout, er = open(dc.Stdout, os.O_WRONLY|os.O_CREATE|os.O_APPEND); er != nil {
+		return 0, er
+	}
+	if cmd.Stderr, er = open(dc.Stderr, os.O_WRONLY|os.O_CREATE|os.O_APPEND); er != nil {
+		return 0, er
+	}
+
+	if er := cmd.Start(); er != nil {
+		return 0, er
+	}
+	pid := cmd.Process.Pid
+	// Reap the daemon should it exit while we are still around.
+	go cmd.Wait()
+
+	if dc.Pidfile != "" {
+		if er := WritePidfile(dc.Pidfile, pid); er != nil {
+			cmd.Process.Kill()
+			return 0, er
+		}
+	}
+	return pid, nil
+}
+
+// WritePidfile atomically writes a pidfile holding pid on its first line
+// and its start time from /proc, if known, on the second.
+func WritePidfile(path string, pid int) error {
+	data := strconv.Itoa(pid) + "\n"
+	if st, er := readStat(pid); er == nil {
+		data += strconv.FormatUint(st.StartTime, 10) + "\n"
+	}
+	return writeFileAtomic(path, []byte(data), 0644)
+}
+
+// ReadPidfile returns the pid in a pidfile and the start time recorded
+// with it, which is 0 for pidfiles that hold only a pid.
+func ReadPidfile(path string) (pid int, started uint64, er error) {
+	f, er := os.Open(path)
+	if er != nil {
+		return 0, 0, er
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	if !s.Scan() {
+		if s.Err() != nil {
+			return 0, 0, s.Err()
+		}
+		return 0, 0, badPidfile(path + ": empty pidfile")
+	}
+	if pid, er = strconv.Atoi(strings.TrimSpace(s.Text())); er != nil || pid < 1 {
+		return 0, 0, badPidfile(fmt.Sprintf("%s: bad pid %q", path, s.Text()))
+	}
+	if s.Scan() && strings.TrimSpace(s.Text()) != "" {
+		if started, er = strconv.ParseUint(strings.TrimSpace(s.Text()), 10, 64); er != nil {
+			return 0, 0, badPidfile(fmt.Sprintf("%s: bad start time %q", path, s.Text()))
+		}
+	}
+	return pid, started, s.Err()
+}
+
+// badPidfile is returned by ReadPidfile for a pidfile it cannot parse.
+type badPidfile string
+
+func (e badPidfile) Error() string {
+	return string(e)
+}
+
+// lockPidfile takes an exclusive lock beside path and returns a func that
+// releases it.
+func lockPidfile(path string) (func(), error) {
+	f, er := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if er != nil {
+		return nil, er
+	}
+	if er := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); er != nil {
+		f.Close()
+		return nil, er
+	}
+	return func() { f.Close() }, nil
+}
+
+// CheckPidfile returns the pid recorded in a pidfile if that process is
+// still running, or ErrNotRunning. A process whose start time differs from
+// the recorded one has reused the pid, not the original process. Stale
+// pidfiles, and ones that cannot be parsed, are removed; other errors
+// reading the pidfile are returned.
+func CheckPidfile(path string) (int, error) {
+	pid, started, er := ReadPidfile(path)
+	if os.IsNotExist(er) {
+		return 0, ErrNotRunning
+	}
+	if _, ok := er.(badPidfile); ok {
+		os.Remove(path)
+		return 0, ErrNotRunning
+	}
+	if er != nil {
+		return 0, er
+	}
+	if !alive(pid, started) {
+		os.Remove(path)
+		return 0, ErrNotRunning
+	}
+	return pid, nil
+}
+
+func alive(pid int, started uint64) bool {
+	st, er := readStat(pid)
+	if er != nil || st.State == 'Z' {
+		return false
+	}
+	return started == 0 || st.StartTime == started
+}
+
+// SignalPidfile sends sig to the process recorded in a pidfile, or to its
+// whole process group if it leads one, as a daemon does.
+func SignalPidfile(path string, sig syscall.Signal) error {
+	pid, er := CheckPidfile(path)
+	if er != nil {
+		return er
+	}
+	if st, er := readStat(pid); er == nil && st.Pgrp == pid {
+		if er := syscall.Kill(-pid, sig); er != syscall.ESRCH {
+			return er
+		}
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// StopPidfile sends SIGTERM to the process recorded in a pidfile and kills
+// it if it has not exited after grace. The pidfile is removed once the
+// process is gone.
+func StopPidfile(path string, grace time.Duration) error {
+	if er := SignalPidfile(path, syscall.SIGTERM); er != nil {
+		return er
+	}
+	pid, started, er := ReadPidfile(path)
+	if er != nil {
+		return er
+	}
+
+	deadline := time.Now().Add(grace)
+	for alive(pid, started) {
+		if time.Now().After(deadline) {
+			if er := SignalPidfile(path, syscall.SIGKILL); er != nil && er != ErrNotRunning {
+				return er
+			}
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	os.Remove(path)
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file beside path and renames
+// it into place, so readers never see a partial write.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, er := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if er != nil {
+		return er
+	}
+	if _, er := f.Write(data); er != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return er
+	}
+	if er := f.Chmod(perm); er != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return er
+	}
+	if er := f.Close(); er != nil {
+		os.Remove(f.Name())
+		return er
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,139 @@
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDaemonize(t *testing.T) {
+	is := assert.New(t)
+	dir, er := ioutil.TempDir("", "daemon")
+	is.NoError(er)
+	defer os.RemoveAll(dir)
+
+	var (
+		pidfile = filepath.Join(dir, "d.pid")
+		dc      = DaemonConfig{
+			Pidfile: pidfile,
+			Stdout:  filepath.Join(dir, "out.log"),
+			Stderr:  filepath.Join(dir, "err.log"),
+		}
+	)
+	p, er := New("daemon", "sh -c 'echo out; echo err >&2; sleep 10'")
+	is.NoError(er)
+	pid, er := p.Daemonize(dc)
+	is.NoError(er)
+
+	st, er := readStat(pid)
+	is.NoError(er)
+	is.Equal(pid, st.Session)
+	b, er := ioutil.ReadFile(pidfile)
+	is.NoError(er)
+	is.Equal(fmt.Sprintf("%d\n%d\n", pid, st.StartTime), string(b))
+
+	running, er := CheckPidfile(pidfile)
+	is.NoError(er)
+	is.Equal(pid, running)
+	_, er = p.Daemonize(dc)
+	is.Error(er)
+
+	for _, log := range []string{"out", "err"} {
+		path := filepath.Join(dir, log+".log")
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			b, _ := ioutil.ReadFile(path)
+			if strings.TrimSpace(string(b)) == log {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s.log has %q", log, b)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	is.NoError(StopPidfile(pidfile, time.Second))
+	_, er = os.Stat(pidfile)
+	is.True(os.IsNotExist(er))
+	is.False(alive(pid, st.StartTime))
+	is.Equal(ErrNotRunning, StopPidfile(pidfile, time.Second))
+}
+
+func TestCheckPidfile(t *testing.T) {
+	is := assert.New(t)
+	dir, er := ioutil.TempDir("", "pidfile")
+	is.NoError(er)
+	defer os.RemoveAll(dir)
+
+	self, er := readStat(os.Getpid())
+	is.NoError(er)
+	var tests = []struct {
+		run      int
+		contents string
+		pid      int
+		err      error
+	}{
+		{1, fmt.Sprintf("%d\n%d\n", self.Pid, self.StartTime), self.Pid, nil},
+		{2, fmt.Sprintf("%d\n", self.Pid), self.Pid, nil},
+		{3, fmt.Sprintf("%d\n%d\n", self.Pid, self.StartTime+1), 0, ErrNotRunning},
+		{4, "999999999\n", 0, ErrNotRunning},
+		{5, "garbage\n", 0, ErrNotRunning},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, "test.pid")
+		is.NoError(ioutil.WriteFile(path, []byte(test.contents), 0644), "test %d", test.run)
+		pid, er := CheckPidfile(path)
+		is.Equal(test.err, er, "test %d", test.run)
+		is.Equal(test.pid, pid, "test %d", test.run)
+
+		_, er = os.Stat(path)
+		is.Equal(test.err != nil, os.IsNotExist(er), "test %d: stale pidfile removal", test.run)
+	}
+
+	// A pidfile that cannot be read is reported, not removed.
+	path := filepath.Join(dir, "dir.pid")
+	is.NoError(os.Mkdir(path, 0755))
+	_, er = CheckPidfile(path)
+	is.Error(er)
+	is.NotEqual(ErrNotRunning, er)
+	_, er = os.Stat(path)
+	is.NoError(er)
+}
+
+func TestDaemonizeConcurrent(t *testing.T) {
+	is := assert.New(t)
+	dir, er := ioutil.TempDir("", "daemon")
+	is.NoError(er)
+	defer os.RemoveAll(dir)
+	dc := DaemonConfig{Pidfile: filepath.Join(dir, "d.pid")}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		started int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, _ := New("daemon", "sleep 10")
+			if _, er := p.Daemonize(dc); er == nil {
+				mu.Lock()
+				started++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	is.Equal(1, started)
+	is.NoError(StopPidfile(dc.Pidfile, time.Second))
+}
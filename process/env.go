@@ -0,0 +1,261 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var secretMarkers = []string{"SECRET", "PASSWORD", "PASSWD", "TOKEN", "KEY", "CREDENTIAL"}
+
+// Env builds the environment for a Process. Allow, Deny and AllowPrefix
+// filter only the variables inherited from the parent; variables that are
+// Set or loaded from a file are always kept unless they are Unset.
+type Env struct {
+	vars      map[string]string
+	inherited map[string]bool
+	allow     map[string]bool
+	deny      map[string]bool
+	prefixes  []string
+	secrets   map[string]bool
+}
+
+func NewEnv() *Env {
+	return &Env{
+		vars:      make(map[string]string),
+		inherited: make(map[string]bool),
+		allow:     make(map[string]bool),
+		deny:      make(map[string]bool),
+		secrets:   make(map[string]bool),
+	}
+}
+
+// Inherit copies the environment of the current process.
+func (e *Env) Inherit() *Env {
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			e.vars[kv[:i]] = kv[i+1:]
+			e.inherited[kv[:i]] = true
+		}
+	}
+	return e
+}
+
+func (e *Env) Set(key, value string) *Env {
+	e.vars[key] = value
+	delete(e.inherited, key)
+	return e
+}
+
+// SetExpanded sets key to value with $VAR and ${VAR} expanded against the
+// environment of the current process.
+func (e *Env) SetExpanded(key, value string) *Env {
+	return e.Set(key, os.ExpandEnv(value))
+}
+
+func (e *Env) Unset(keys ...string) *Env {
+	for _, k := range keys {
+		delete(e.vars, k)
+		delete(e.inherited, k)
+	}
+	return e
+}
+
+// Allow keeps only the named inherited variables, along with any allowed
+// by AllowPrefix.
+func (e *Env) Allow(keys ...string) *Env {
+	for _, k := range keys {
+		e.allow[k] = true
+	}
+	return e
+}
+
+// AllowPrefix keeps only inherited variables whose names start with one of
+// prefixes, along with any allowed by Allow.
+func (e *Env) AllowPrefix(prefixes ...string) *Env {
+	e.prefixes = append(e.prefixes, prefixes...)
+	return e
+}
+
+// Deny drops the named inherited variables.
+func (e *Env) Deny(keys ...string) *Env {
+	for _, k := range keys {
+		e.deny[k] = true
+	}
+	return e
+}
+
+// Secret marks keys whose values are redacted by String and Redacted.
+// Names with a _-separated part of SECRET, PASSWORD, PASSWD, TOKEN, KEY or
+// CREDENTIAL, or their plurals, are always treated as secret, so
+// AWS_SECRET_ACCESS_KEY is but KEYBOARD is not.
+func (e *Env) Secret(keys ...string) *Env {
+	for _, k := range keys {
+		e.secrets[k] = true
+	}
+	return e
+}
+
+// LoadFile sets every variable defined in the env file at path, taking
+// the values literally. See ReadEnvFile for the format.
+func (e *Env) LoadFile(path string) error {
+	return e.loadFile(path, false)
+}
+
+// LoadFileExpanded is LoadFile with ${VAR} references in the values
+// expanded against the environment of the current process.
+func (e *Env) LoadFileExpanded(path string) error {
+	return e.loadFile(path, true)
+}
+
+func (e *Env) loadFile(path string, expand bool) error {
+	vars, er := ReadEnvFile(path, expand)
+	if er != nil {
+		return er
+	}
+	for k, v := range vars {
+		e.Set(k, v)
+	}
+	return nil
+}
+
+func (e *Env) Get(key string) (string, bool) {
+	if !e.keep(key) {
+		return "", false
+	}
+	v, ok := e.vars[key]
+	return v, ok
+}
+
+// Environ returns the environment as sorted KEY=value pairs, suitable for
+// Process.SetEnv.
+func (e *Env) Environ() []string {
+	env := make([]string, 0, len(e.vars))
+	for _, k := range e.keys() {
+		env = append(env, k+"="+e.vars[k])
+	}
+	return env
+}
+
+// Redacted is like Environ but with secret values replaced.
+func (e *Env) Redacted() []string {
+	env := make([]string, 0, len(e.vars))
+	for _, k := range e.keys() {
+		v := e.vars[k]
+		if e.isSecret(k) {
+			v = "<redacted>"
+		}
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+func (e *Env) String() string {
+	return strings.Join(e.Redacted(), " ")
+}
+
+func (e *Env) keys() []string {
+	keys := make([]string, 0, len(e.vars))
+	for k := range e.vars {
+		if e.keep(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *Env) keep(key string) bool {
+	if !e.inherited[key] {
+		return true
+	}
+	if e.deny[key] {
+		return false
+	}
+	if len(e.allow) < 1 && len(e.prefixes) < 1 {
+		return true
+	}
+	if e.allow[key] {
+		return true
+	}
+	for _, pre := range e.prefixes {
+		if strings.HasPrefix(key, pre) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Env) isSecret(key string) bool {
+	if e.secrets[key] {
+		return true
+	}
+	for _, seg := range strings.Split(strings.ToUpper(key), "_") {
+		for _, m := range secretMarkers {
+			if seg == m || seg == m+"S" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetEnvironment sets the process environment to a snapshot of e.
+func (p *Process) SetEnvironment(e *Env) *Process {
+	return p.SetEnv(e.Environ())
+}
+
+// ReadEnvFile parses an env file of KEY=value lines. Comments, lines
+// without a KEY= and a leading "export " are ignored. Double quoted values
+// are unquoted Go-style. With expand, double quoted and bare values have
+// ${VAR} references expanded against the current environment; single
+// quoted values are always taken literally.
+func ReadEnvFile(path string, expand bool) (map[string]string, error) {
+	f, er := os.Open(path)
+	if er != nil {
+		return nil, er
+	}
+	defer f.Close()
+
+	var (
+		vars = make(map[string]string)
+		s    = bufio.NewScanner(f)
+		n    int
+	)
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		switch {
+		case len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"':
+			uq, er := strconv.Unquote(value)
+			if er != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, n, er)
+			}
+			value = uq
+			if expand {
+				value = os.ExpandEnv(value)
+			}
+		default:
+			if expand {
+				value = os.ExpandEnv(value)
+			}
+		}
+		vars[key] = value
+	}
+	return vars, s.Err()
+}
@@ -0,0 +1,103 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnv(t *testing.T) {
+	is := assert.New(t)
+	os.Setenv("GEARBOX_TEST_A", "a")
+	os.Setenv("GEARBOX_TEST_B", "b")
+	os.Setenv("GEARBOX_OTHER", "o")
+	defer os.Unsetenv("GEARBOX_TEST_A")
+	defer os.Unsetenv("GEARBOX_TEST_B")
+	defer os.Unsetenv("GEARBOX_OTHER")
+
+	var tests = []struct {
+		run      int
+		env      *Env
+		expected []string
+	}{
+		{1, NewEnv().Set("B", "2").Set("A", "1"), []string{"A=1", "B=2"}},
+		{2, NewEnv().Inherit().AllowPrefix("GEARBOX_TEST_"), []string{"GEARBOX_TEST_A=a", "GEARBOX_TEST_B=b"}},
+		{3, NewEnv().Inherit().AllowPrefix("GEARBOX_TEST_").Deny("GEARBOX_TEST_A"), []string{"GEARBOX_TEST_B=b"}},
+		{4, NewEnv().Inherit().Allow("GEARBOX_OTHER").Set("X", "y"), []string{"GEARBOX_OTHER=o", "X=y"}},
+		{5, NewEnv().Inherit().Allow("NOPE"), []string{}},
+		{6, NewEnv().Set("A", "1").Unset("A"), []string{}},
+		{7, NewEnv().SetExpanded("P", "${GEARBOX_TEST_A}-$GEARBOX_TEST_B"), []string{"P=a-b"}},
+	}
+
+	for _, test := range tests {
+		is.Equal(test.expected, test.env.Environ(), "test %d", test.run)
+	}
+}
+
+func TestEnvRedacted(t *testing.T) {
+	is := assert.New(t)
+	e := NewEnv().Set("API_TOKEN", "t").Set("DB_PASSWORD", "p").Set("NAME", "n").Set("CUSTOM", "c").Secret("CUSTOM")
+	is.Equal([]string{"API_TOKEN=<redacted>", "CUSTOM=<redacted>", "DB_PASSWORD=<redacted>", "NAME=n"}, e.Redacted())
+	is.NotContains(e.String(), "=p")
+
+	var tests = []struct {
+		run    int
+		key    string
+		secret bool
+	}{
+		{1, "AWS_SECRET_ACCESS_KEY", true},
+		{2, "db_passwd", true},
+		{3, "SSH_KEYS", true},
+		{4, "KEYBOARD", false},
+		{5, "MONKEY_PATCH", false},
+		{6, "TOKENIZER", false},
+	}
+	for _, test := range tests {
+		is.Equal(test.secret, NewEnv().isSecret(test.key), "test %d", test.run)
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	is := assert.New(t)
+	os.Setenv("GEARBOX_TEST_HOME", "/home/x")
+	defer os.Unsetenv("GEARBOX_TEST_HOME")
+
+	f, er := ioutil.TempFile("", "env")
+	is.NoError(er)
+	defer os.Remove(f.Name())
+	f.WriteString(`# comment
+
+export A=1
+B = two words
+C="line\nbreak ${GEARBOX_TEST_HOME}"
+D='$GEARBOX_TEST_HOME'
+E=${GEARBOX_TEST_HOME}/bin
+F=x=y
+not a variable
+`)
+	f.Close()
+
+	vars, er := ReadEnvFile(f.Name(), true)
+	is.NoError(er)
+	is.Equal(map[string]string{
+		"A": "1",
+		"B": "two words",
+		"C": "line\nbreak /home/x",
+		"D": "$GEARBOX_TEST_HOME",
+		"E": "/home/x/bin",
+		"F": "x=y",
+	}, vars)
+
+	vars, er = ReadEnvFile(f.Name(), false)
+	is.NoError(er)
+	is.Equal(map[string]string{
+		"A": "1",
+		"B": "two words",
+		"C": "line\nbreak ${GEARBOX_TEST_HOME}",
+		"D": "$GEARBOX_TEST_HOME",
+		"E": "${GEARBOX_TEST_HOME}/bin",
+		"F": "x=y",
+	}, vars)
+}
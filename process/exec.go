@@ -0,0 +1,110 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Exec replaces the current process with p, applying its environment,
+// directory, credentials, process group or session and rlimits first. It
+// only returns if that fails. The binary is checked before anything is
+// changed, but if exec itself then fails, e.g. with ENOEXEC, the caller
+// is left with p's rlimits, session and credentials.
+//
+// Output writers, tails, subscribers, stdin, probes, watches, cgroups,
+// metrics, expect, pipes and ptys all need a parent to service them, so
+// when any are configured Exec runs p as a child instead, as RunInit does,
+// and exits with its status. It returns an error if the child cannot be
+// started.
+func (p *Process) Exec() error {
+	if !p.canReplace() {
+		status, er := runInit(p)
+		if er != nil {
+			return er
+		}
+		os.Exit(status)
+	}
+
+	cred, env, er := p.credentials()
+	if er != nil {
+		return er
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	bin, er := p.executable()
+	if er != nil {
+		return er
+	}
+
+	if p.dir != "" {
+		wd, er := os.Getwd()
+		if er != nil {
+			return er
+		}
+		if er := os.Chdir(p.dir); er != nil {
+			return er
+		}
+		defer os.Chdir(wd)
+	}
+	if er := setRlimits(p.rlimits); er != nil {
+		return er
+	}
+	switch {
+	case p.setsid:
+		if _, er := syscall.Setsid(); er != nil {
+			return er
+		}
+	case p.pgroup:
+		if er := syscall.Setpgid(0, 0); er != nil {
+			return er
+		}
+	}
+	if er := setCredential(cred); er != nil {
+		return er
+	}
+	return syscall.Exec(bin, append([]string{p.bin}, p.args...), env)
+}
+
+// executable returns the absolute path of the process's binary once it is
+// known to be an executable regular file.
+func (p *Process) executable() (string, error) {
+	bin := p.bin
+	if !filepath.IsAbs(bin) && p.dir != "" && strings.Contains(bin, "/") {
+		bin = filepath.Join(p.dir, bin)
+	}
+	bin, er := exec.LookPath(bin)
+	if er != nil {
+		return "", er
+	}
+	if bin, er = filepath.Abs(bin); er != nil {
+		return "", er
+	}
+	fi, er := os.Stat(bin)
+	if er != nil {
+		return "", er
+	}
+	if !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", bin)
+	}
+	return bin, nil
+}
+
+func (p *Process) canReplace() bool {
+	return !p.tty &&
+		len(p.out)+len(p.stdoutW)+len(p.stderrW) < 1 &&
+		p.outTail == nil &&
+		!p.lines.subscribed() &&
+		p.stdin == nil &&
+		p.capOut == nil && p.capErr == nil &&
+		p.readiness == nil && p.liveness == nil &&
+		p.watch == nil &&
+		p.cgroup == nil &&
+		p.metrics == nil &&
+		p.exp == nil &&
+		p.pipeIn == nil && p.pipeOut == nil
+}
@@ -0,0 +1,80 @@
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExecHelper is run in a child test binary by TestExec, since Exec
+// replaces the process calling it.
+func TestExecHelper(t *testing.T) {
+	mode := os.Getenv("GEARBOX_EXEC_HELPER")
+	if mode == "" {
+		t.Skip("run by TestExec")
+	}
+	p, er := New("exec", `sh -c 'echo $$ $GEARBOX_EXEC_VAR $(pwd); exit 7'`)
+	if er != nil {
+		os.Exit(100)
+	}
+	p.SetEnv([]string{"GEARBOX_EXEC_VAR=hello"}).SetDir("/")
+	if strings.HasSuffix(mode, "fork") {
+		p.RawOutput().AddWriter(os.Stdout)
+	}
+	if strings.HasPrefix(mode, "bad") {
+		// The binary stops being executable after New resolved it.
+		p.bin = os.Getenv("GEARBOX_EXEC_BIN")
+	}
+	fmt.Println(os.Getpid())
+	if er := p.Exec(); er != nil {
+		fmt.Println(os.Getpid(), "exec failed")
+		os.Exit(3)
+	}
+	os.Exit(101)
+}
+
+func TestExec(t *testing.T) {
+	is := assert.New(t)
+	f, er := ioutil.TempFile("", "gearbox-exec")
+	is.NoError(er)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	var tests = []struct {
+		run     int
+		mode    string
+		status  int
+		output  []string
+		replace bool
+	}{
+		{1, "replace", 7, []string{"hello", "/"}, true},
+		{2, "fork", 7, []string{"hello", "/"}, false},
+		{3, "bad-replace", 3, []string{"exec", "failed"}, true},
+		{4, "bad-fork", 3, []string{"exec", "failed"}, true},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestExecHelper$")
+		cmd.Env = append(os.Environ(), "GEARBOX_EXEC_HELPER="+test.mode, "GEARBOX_EXEC_BIN="+f.Name())
+		cmd.Stderr = ioutil.Discard
+		out, er := cmd.Output()
+		is.Error(er, "test %d", test.run)
+		if ee, ok := er.(*exec.ExitError); is.True(ok, "test %d", test.run) {
+			is.Equal(test.status, ee.Sys().(syscall.WaitStatus).ExitStatus(), "test %d", test.run)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if !is.Len(lines, 2, "test %d", test.run) {
+			continue
+		}
+		fields := strings.Fields(lines[1])
+		is.Equal(test.output, fields[1:], "test %d", test.run)
+		is.Equal(test.replace, lines[0] == fields[0], "test %d", test.run)
+	}
+}
@@ -0,0 +1,211 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultExpectTimeout is used by Expect when its context has no deadline
+// and no timeout was given to EnableExpect.
+const DefaultExpectTimeout = 30 * time.Second
+
+// ExpectWindow is the most unmatched output Expect holds on to, and the
+// most Transcript keeps. Older bytes are dropped as new output arrives.
+const ExpectWindow = 64 * 1024
+
+var ErrExpectDisabled = errors.New("expect is not enabled")
+
+// ExpectError is returned when Expect gives up. Err is ErrExited if the
+// process exited first, or the context's error. Output is what the process
+// printed that was left unmatched.
+type ExpectError struct {
+	Pattern string
+	Output  string
+	Err     error
+}
+
+func (e *ExpectError) Error() string {
+	return fmt.Sprintf("expecting %q: %v (unmatched output %q)", e.Pattern, e.Err, e.Output)
+}
+
+// expecter holds the raw output of the current run that Expect has not yet
+// consumed, along with the writer Send uses for the child's stdin.
+type expecter struct {
+	sync.Mutex
+	timeout    time.Duration
+	buf        []byte
+	transcript []byte
+	changed    chan struct{}
+	eof        bool
+	in         io.Writer
+	echo       bool
+}
+
+// EnableExpect lets the process be driven with Expect and Send. Its stdin
+// is then written only by Send, instead of SetStdin or the parent's stdin.
+// A timeout of 0 uses DefaultExpectTimeout.
+func (p *Process) EnableExpect(timeout time.Duration) *Process {
+	if timeout <= 0 {
+		timeout = DefaultExpectTimeout
+	}
+	p.exp = &expecter{timeout: timeout, changed: make(chan struct{})}
+	return p
+}
+
+// reset prepares for a new run whose stdin is in. Input is recorded in the
+// transcript unless the terminal echoes it.
+func (e *expecter) reset(in io.Writer, echo bool) {
+	e.Lock()
+	defer e.Unlock()
+	e.buf = e.buf[:0]
+	e.eof = false
+	e.in = in
+	e.echo = echo
+}
+
+func (e *expecter) Write(b []byte) (int, error) {
+	e.Lock()
+	defer e.Unlock()
+	e.buf = keepLast(append(e.buf, b...), ExpectWindow)
+	e.transcript = keepLast(append(e.transcript, b...), ExpectWindow)
+	e.notify()
+	return len(b), nil
+}
+
+func (e *expecter) close() {
+	e.Lock()
+	defer e.Unlock()
+	e.eof = true
+	e.in = nil
+	e.notify()
+}
+
+// notify wakes every Expect waiting for output. e must be locked.
+func (e *expecter) notify() {
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// Expect waits for the output of the process, since the last match, to
+// match re. Only the last ExpectWindow bytes of that output are matched.
+// It returns the submatches and discards the output up to the end of the
+// match. Stdout and stderr are matched together as they arrive, so
+// prompts without a trailing newline are seen.
+func (p *Process) Expect(ctx context.Context, re *regexp.Regexp) ([]string, error) {
+	e := p.exp
+	if e == nil {
+		return nil, ErrExpectDisabled
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	for {
+		e.Lock()
+		if loc := re.FindSubmatchIndex(e.buf); loc != nil {
+			sm := make([]string, len(loc)/2)
+			for i := range sm {
+				if loc[2*i] >= 0 {
+					sm[i] = string(e.buf[loc[2*i]:loc[2*i+1]])
+				}
+			}
+			e.buf = append(e.buf[:0], e.buf[loc[1]:]...)
+			e.Unlock()
+			return sm, nil
+		}
+		var (
+			eof     = e.eof
+			changed = e.changed
+			out     = string(e.buf)
+		)
+		e.Unlock()
+
+		if eof {
+			return nil, &ExpectError{Pattern: re.String(), Output: out, Err: ErrExited}
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, &ExpectError{Pattern: re.String(), Output: out, Err: ctx.Err()}
+		}
+	}
+}
+
+// Send writes text to the stdin of the running process.
+func (p *Process) Send(text string) error {
+	e := p.exp
+	if e == nil {
+		return ErrExpectDisabled
+	}
+	e.Lock()
+	in := e.in
+	if in != nil && !e.echo {
+		e.transcript = keepLast(append(e.transcript, text...), ExpectWindow)
+	}
+	e.Unlock()
+
+	// The lock is not held while writing, since the child may be blocked
+	// writing output that Write needs the lock for.
+	if in == nil {
+		return ErrExited
+	}
+	_, er := io.WriteString(in, text)
+	return er
+}
+
+func (p *Process) SendLine(text string) error {
+	return p.Send(text + "\n")
+}
+
+// SendEOF closes the stdin of the running process, or sends the EOF
+// character if it runs on a pty.
+func (p *Process) SendEOF() error {
+	e := p.exp
+	if e == nil {
+		return ErrExpectDisabled
+	}
+	e.Lock()
+	in, echo := e.in, e.echo
+	e.Unlock()
+
+	if in == nil {
+		return ErrExited
+	}
+	if echo {
+		_, er := io.WriteString(in, "\x04")
+		return er
+	}
+	if c, ok := in.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Transcript returns what the process printed and, unless it runs on a pty
+// that echoes it, what was sent to it, across all runs. Only the last
+// ExpectWindow bytes are kept.
+func (p *Process) Transcript() string {
+	e := p.exp
+	if e == nil {
+		return ""
+	}
+	e.Lock()
+	defer e.Unlock()
+	return string(e.transcript)
+}
+
+// keepLast drops all but the last n bytes of b, reusing its storage.
+func keepLast(b []byte, n int) []byte {
+	if len(b) <= n {
+		return b
+	}
+	return append(b[:0], b[len(b)-n:]...)
+}
@@ -0,0 +1,80 @@
+package process
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestExpect(t *testing.T) {
+	is := assert.New(t)
+	script := `printf 'Name: '; read name; printf 'Really %s? [y/n] ' "$name"; read ok; echo "done $ok"`
+	var tests = []struct {
+		run int
+		tty bool
+	}{
+		{1, false},
+		{2, true},
+	}
+
+	for _, test := range tests {
+		p, er := NewArgv("prompt", []string{"sh", "-c", script})
+		is.NoError(er, "test %d", test.run)
+		p.EnableExpect(5 * time.Second)
+		if test.tty {
+			p.MakeInteractive()
+		}
+		is.NoError(p.Execute(context.Background()), "test %d", test.run)
+
+		_, er = p.Expect(context.Background(), regexp.MustCompile(`Name: $`))
+		is.NoError(er, "test %d", test.run)
+		is.NoError(p.SendLine("chef"), "test %d", test.run)
+		m, er := p.Expect(context.Background(), regexp.MustCompile(`Really (\w+)\? \[y/n\] `))
+		is.NoError(er, "test %d", test.run)
+		is.Equal([]string{"Really chef? [y/n] ", "chef"}, m, "test %d", test.run)
+		is.NoError(p.SendLine("y"), "test %d", test.run)
+		_, er = p.Expect(context.Background(), regexp.MustCompile(`done y`))
+		is.NoError(er, "test %d", test.run)
+
+		<-p.Exited()
+		is.NoError(p.Error(), "test %d", test.run)
+		is.Equal(ErrExited, p.Send("late"), "test %d", test.run)
+		tr := strings.Replace(p.Transcript(), "\r", "", -1)
+		is.Equal("Name: chef\nReally chef? [y/n] y\ndone y\n", tr, "test %d", test.run)
+
+		_, er = p.Expect(context.Background(), regexp.MustCompile(`never`))
+		is.Equal(ErrExited, er.(*ExpectError).Err, "test %d", test.run)
+	}
+}
+
+func TestExpectTimeout(t *testing.T) {
+	is := assert.New(t)
+	p, er := NewArgv("silent", []string{"sh", "-c", "echo hello; sleep 10"})
+	is.NoError(er)
+	p.SetProcessGroup().EnableExpect(50 * time.Millisecond)
+	is.NoError(p.Execute(context.Background()))
+	defer p.Kill()
+
+	_, er = p.Expect(context.Background(), regexp.MustCompile(`goodbye`))
+	is.Error(er)
+	e := er.(*ExpectError)
+	is.Equal(context.DeadlineExceeded, e.Err)
+	is.Equal("hello\n", e.Output)
+}
+
+func TestExpectWindow(t *testing.T) {
+	is := assert.New(t)
+	e := &expecter{changed: make(chan struct{})}
+	chunk := []byte(strings.Repeat("x", ExpectWindow/2))
+	for i := 0; i < 5; i++ {
+		e.Write(chunk)
+	}
+	e.Write([]byte("end"))
+	is.Len(e.buf, ExpectWindow)
+	is.Len(e.transcript, ExpectWindow)
+	is.True(strings.HasSuffix(string(e.buf), "xend"))
+}
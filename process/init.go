@@ -0,0 +1,89 @@
+package process
+
+import (
+	"log"
+	"os"
+	"sync"
+	"syscall"
+
+	"golang.org/x/net/context"
+)
+
+// InitSignals are forwarded to the main child by RunInit.
+var InitSignals = []os.Signal{
+	syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT,
+	syscall.SIGUSR1, syscall.SIGUSR2,
+}
+
+// reaper tracks the children started as a Process so that reaping orphans
+// never steals the exit status of a process being waited on. Starting a
+// Process holds a read lock until its pid is registered; collecting holds
+// the write lock.
+type reaper struct {
+	sync.RWMutex
+	mu      sync.Mutex
+	managed map[int]bool
+}
+
+var reap = newReaper()
+
+func newReaper() *reaper {
+	return &reaper{managed: make(map[int]bool)}
+}
+
+func (r *reaper) manage(pid int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.managed[pid] = true
+}
+
+func (r *reaper) release(pid int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.managed, pid)
+}
+
+func (r *reaper) isManaged(pid int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.managed[pid]
+}
+
+// IsInit reports whether this process is running as PID 1.
+func IsInit() bool {
+	return os.Getpid() == 1
+}
+
+// RunInit runs p as the main child of an init process: when running as
+// PID 1 it starts a reaper for orphaned processes, InitSignals are
+// forwarded to p, and the returned status is p's exit code, or 128 plus
+// the signal number if it was killed by a signal. Children started with
+// os/exec directly rather than as a Process may be reaped out from under
+// their Wait.
+func RunInit(p *Process) int {
+	status, er := runInit(p)
+	if er != nil {
+		log.Printf("[error] could not start %v: %v", p, er)
+		return 127
+	}
+	return status
+}
+
+// runInit is RunInit, returning the error instead if p cannot be started.
+func runInit(p *Process) (int, error) {
+	if IsInit() {
+		if er := StartReaper(); er != nil {
+			log.Printf("[warn] running as pid 1 without reaping: %v", er)
+		}
+	}
+	p.ForwardSignals(InitSignals...)
+
+	r, er := p.Run(context.Background())
+	if r == nil {
+		return 0, er
+	}
+	if er != nil {
+		log.Printf("[info] %v exited: %v", p, er)
+	}
+	return r.Status(), nil
+}
@@ -0,0 +1,65 @@
+package process
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var reaperOnce sync.Once
+
+// StartReaper makes this process a child subreaper, so that orphaned
+// descendants are re-parented to it, and reaps them as they exit. Children
+// started as a Process are left to their own Wait.
+func StartReaper() error {
+	var er error
+	reaperOnce.Do(func() {
+		if er = unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); er != nil {
+			return
+		}
+		go reap.run()
+	})
+	return er
+}
+
+func (r *reaper) run() {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGCHLD)
+	// SIGCHLD may be coalesced, so collect periodically as well.
+	tick := time.NewTicker(time.Second)
+	for {
+		select {
+		case <-sigc:
+		case <-tick.C:
+		}
+		r.collect()
+	}
+}
+
+// collect reaps every zombie child that is not a managed Process. Zombies
+// are found through /proc so that unrelated children are never waited on.
+func (r *reaper) collect() {
+	r.Lock()
+	defer r.Unlock()
+
+	procs, er := listProcs()
+	if er != nil {
+		log.Printf("[warn] reaper could not list processes: %v", er)
+		return
+	}
+	self := os.Getpid()
+	for _, st := range procs {
+		if st.PPid != self || st.State != 'Z' || r.isManaged(st.Pid) {
+			continue
+		}
+		var ws unix.WaitStatus
+		if pid, er := unix.Wait4(st.Pid, &ws, unix.WNOHANG, nil); er == nil && pid > 0 {
+			log.Printf("[debug] reaped orphan pid=%d status=%d", pid, ws.ExitStatus())
+		}
+	}
+}
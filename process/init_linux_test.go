@@ -0,0 +1,51 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+)
+
+func TestReaper(t *testing.T) {
+	is := assert.New(t)
+
+	// Drive a reaper of our own rather than the package one, so that no
+	// reaping goroutine or subreaper flag outlives the test.
+	if er := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); er != nil {
+		t.Skipf("cannot become a subreaper: %v", er)
+	}
+	defer unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 0, 0, 0, 0)
+	rp := newReaper()
+
+	// The backgrounded sleeps are orphaned when sh exits and re-parented
+	// to the test process.
+	p, er := New("orphans", "sh -c 'sleep 0.05 & echo $!; sleep 0.05 & echo $!; exit 3'")
+	is.NoError(er)
+	out, r, er := p.Output(context.Background())
+	is.Error(er)
+	is.Equal(3, r.Status())
+
+	pids := strings.Fields(string(out))
+	is.Len(pids, 2)
+	deadline := time.Now().Add(5 * time.Second)
+	for _, pid := range pids {
+		for exists(pid) {
+			if time.Now().After(deadline) {
+				t.Fatalf("orphan %s was not reaped", pid)
+			}
+			time.Sleep(50 * time.Millisecond)
+			rp.collect()
+		}
+	}
+}
+
+func exists(pid string) bool {
+	_, er := os.Stat(filepath.Join(procRoot, pid))
+	return er == nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import "errors"
+
+func StartReaper() error {
+	return errors.New("reaping orphans is only supported on linux")
+}
@@ -0,0 +1,218 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Line is a single line of output read from a process.
+type Line struct {
+	Stream Stream
+	Text   string
+	Time   time.Time
+	Pid    int
+}
+
+// Formatter renders a line of output from the named process for the
+// writers added to a Process.
+type Formatter func(name string, l Line) string
+
+func DefaultFormatter(name string, l Line) string {
+	return fmt.Sprintf("[%s] %s", name, l.Text)
+}
+
+func RawFormatter(name string, l Line) string {
+	return l.Text
+}
+
+// DetailedFormatter prefixes each line with its time in layout, the
+// process name, its pid and the stream it came from.
+func DetailedFormatter(layout string) Formatter {
+	return func(name string, l Line) string {
+		return fmt.Sprintf("%s [%s pid=%d %s] %s", l.Time.Format(layout), name, l.Pid, l.Stream, l.Text)
+	}
+}
+
+// Subscription receives every line of output a process produces from the
+// time it is created until Close is called. C is never closed. Lines are
+// delivered in order, and dropped while C is full, so that a subscriber
+// that stops reading never holds up the process or its exit.
+type Subscription struct {
+	C    <-chan Line
+	c    chan Line
+	once sync.Once
+	hub  *lineHub
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.Lock()
+		delete(s.hub.subs, s)
+		s.hub.Unlock()
+	})
+}
+
+// outputBacklog is how many of the latest lines of a run are kept for
+// WaitForOutput to match.
+const outputBacklog = 64
+
+type lineHub struct {
+	sync.RWMutex
+	subs    map[*Subscription]struct{}
+	waiters map[*OutputWaiter]struct{}
+	recent  []Line
+	eof     chan struct{}
+	running bool
+	ran     bool
+}
+
+// begin marks the start of a run's output.
+func (h *lineHub) begin() {
+	h.Lock()
+	defer h.Unlock()
+	if h.eof == nil {
+		h.eof = make(chan struct{})
+	}
+	h.running, h.ran = true, true
+	h.recent = nil
+}
+
+// end marks the end of a run's output. Every line of the run has been
+// published by the time it is called.
+func (h *lineHub) end() {
+	h.Lock()
+	defer h.Unlock()
+	if h.eof != nil {
+		close(h.eof)
+		h.eof = nil
+	}
+	h.running = false
+}
+
+// done returns a channel closed when the output of the current run ends.
+// If no run has begun yet it is closed at the end of the next one; if the
+// last run has already ended it is closed. h must be locked.
+func (h *lineHub) done() <-chan struct{} {
+	if h.ran && !h.running {
+		eof := make(chan struct{})
+		close(eof)
+		return eof
+	}
+	return h.next()
+}
+
+// next returns a channel closed when the output of the current run ends,
+// or of the next run to begin if none is running. h must be locked.
+func (h *lineHub) next() <-chan struct{} {
+	if h.eof == nil {
+		h.eof = make(chan struct{})
+	}
+	return h.eof
+}
+
+func (h *lineHub) subscribed() bool {
+	h.RLock()
+	defer h.RUnlock()
+	return len(h.subs) > 0
+}
+
+func (h *lineHub) subscribe(buffer int) *Subscription {
+	c := make(chan Line, buffer)
+	s := &Subscription{C: c, c: c, hub: h}
+
+	h.Lock()
+	defer h.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[*Subscription]struct{})
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// watch starts matching lines for w. With backlog, the lines kept from
+// the current or last run are matched first, and w ends with that run;
+// otherwise it ends with the current run or the next to begin.
+func (h *lineHub) watch(w *OutputWaiter, backlog bool) {
+	h.Lock()
+	defer h.Unlock()
+	if !backlog {
+		w.eof = h.next()
+	} else {
+		w.eof = h.done()
+		for _, l := range h.recent {
+			if w.offer(l) {
+				return
+			}
+		}
+	}
+	if h.waiters == nil {
+		h.waiters = make(map[*OutputWaiter]struct{})
+	}
+	h.waiters[w] = struct{}{}
+}
+
+func (h *lineHub) unwatch(w *OutputWaiter) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.waiters, w)
+}
+
+func (h *lineHub) publish(l Line) {
+	h.Lock()
+	defer h.Unlock()
+	h.recent = append(h.recent, l)
+	if len(h.recent) > outputBacklog {
+		h.recent = h.recent[1:]
+	}
+	for w := range h.waiters {
+		if w.offer(l) {
+			delete(h.waiters, w)
+		}
+	}
+	for s := range h.subs {
+		select {
+		case s.c <- l:
+		default:
+		}
+	}
+}
+
+// lineWriter publishes the lines written to it, for output that is copied
+// rather than read by stream, as a pty's is.
+type lineWriter struct {
+	p   *Process
+	pid int
+	buf []byte
+}
+
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.publish(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= maxLine {
+		w.flush()
+	}
+	return len(b), nil
+}
+
+// flush publishes any partial line left at the end of the output.
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.publish(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) publish(b []byte) {
+	text := strings.TrimSuffix(string(b), "\r")
+	w.p.lines.publish(Line{Stream: Stdout, Text: text, Time: time.Now(), Pid: w.pid})
+}
@@ -0,0 +1,94 @@
+package process
+
+import (
+	"errors"
+	"regexp"
+
+	"golang.org/x/net/context"
+)
+
+var ErrExited = errors.New("process exited")
+
+// Match is a line of output that matched a pattern. Submatches holds the
+// text of the whole match followed by each capture group, as returned by
+// Regexp.FindStringSubmatch.
+type Match struct {
+	Line
+	Submatches []string
+}
+
+// WaitForOutput blocks until a line of stdout or stderr matches re and
+// returns it. The latest lines of the current run, or of the last one if
+// the process has exited, are matched first, so a line printed soon after
+// Execute is not missed. It gives up with ErrExited once the run's output
+// ends without a match, or with ctx's error.
+func (p *Process) WaitForOutput(ctx context.Context, re *regexp.Regexp) (*Match, error) {
+	w := &OutputWaiter{re: re, hub: &p.lines, found: make(chan struct{})}
+	p.lines.watch(w, true)
+	return w.Wait(ctx)
+}
+
+// OutputWaiter waits for a line of output that matches a pattern. It sees
+// every line from the time it was created by AwaitOutput.
+type OutputWaiter struct {
+	re    *regexp.Regexp
+	hub   *lineHub
+	eof   <-chan struct{}
+	found chan struct{}
+	m     *Match
+}
+
+// AwaitOutput starts watching for a line of stdout or stderr that matches
+// re in the current run, or in the next one if the process is not running.
+// Calling it before Execute guarantees that no line of the run is missed.
+// Wait returns the match; Close stops watching if Wait is not called.
+func (p *Process) AwaitOutput(re *regexp.Regexp) *OutputWaiter {
+	w := &OutputWaiter{re: re, hub: &p.lines, found: make(chan struct{})}
+	p.lines.watch(w, false)
+	return w
+}
+
+// Wait blocks until a matching line is seen and returns it, like
+// WaitForOutput, and then closes the waiter.
+func (w *OutputWaiter) Wait(ctx context.Context) (*Match, error) {
+	defer w.Close()
+	select {
+	case <-w.found:
+		return w.m, nil
+	case <-w.eof:
+		// Lines are matched as they are published, before the run's
+		// output ends.
+		select {
+		case <-w.found:
+			return w.m, nil
+		default:
+			return nil, ErrExited
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (w *OutputWaiter) Close() {
+	w.hub.unwatch(w)
+}
+
+// offer matches l and reports whether w has found its line. The hub must
+// be locked.
+func (w *OutputWaiter) offer(l Line) bool {
+	m := match(w.re, l)
+	if m == nil {
+		return false
+	}
+	w.m = m
+	close(w.found)
+	return true
+}
+
+func match(re *regexp.Regexp, l Line) *Match {
+	sm := re.FindStringSubmatch(l.Text)
+	if sm == nil {
+		return nil
+	}
+	return &Match{Line: l, Submatches: sm}
+}
@@ -0,0 +1,101 @@
+package process
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestWaitForOutput(t *testing.T) {
+	is := assert.New(t)
+	re := regexp.MustCompile(`listening on (\S+):(\d+)`)
+	var tests = []struct {
+		run      int
+		cmd      string
+		tty      bool
+		timeout  time.Duration
+		expected []string
+		stream   Stream
+		err      error
+	}{
+		{1, "sh -c 'echo starting; echo listening on 127.0.0.1:8080; sleep 10'", false, 5 * time.Second, []string{"listening on 127.0.0.1:8080", "127.0.0.1", "8080"}, Stdout, nil},
+		{2, "sh -c 'echo listening on :0:9000 >&2; sleep 10'", false, 5 * time.Second, []string{"listening on :0:9000", ":0", "9000"}, Stderr, nil},
+		{3, "sh -c 'echo nope'", false, 5 * time.Second, nil, Stdout, ErrExited},
+		{4, "sleep 10", false, 50 * time.Millisecond, nil, Stdout, context.DeadlineExceeded},
+		{5, "sh -c 'echo listening on tty:1; sleep 10'", true, 5 * time.Second, []string{"listening on tty:1", "tty", "1"}, Stdout, nil},
+	}
+
+	for _, test := range tests {
+		p, er := New("wait", test.cmd)
+		is.NoError(er, "test %d", test.run)
+		p.SetProcessGroup()
+		if test.tty {
+			p.MakeInteractive().SetStdin(strings.NewReader("")).AddWriter(ioutil.Discard)
+		}
+
+		// Armed before Execute, so the first line cannot be missed.
+		w := p.AwaitOutput(re)
+		c, q := context.WithTimeout(context.Background(), test.timeout)
+		is.NoError(p.Execute(context.Background()), "test %d", test.run)
+		m, er := w.Wait(c)
+		q()
+		is.Equal(test.err, er, "test %d", test.run)
+		if test.err == nil {
+			is.Equal(test.expected, m.Submatches, "test %d", test.run)
+			is.Equal(test.stream, m.Stream, "test %d", test.run)
+			is.Equal(p.Pid(), m.Pid, "test %d", test.run)
+		}
+		p.Kill()
+		<-p.Exited()
+
+		// Once the run is over only the lines it left can match.
+		m, er = p.WaitForOutput(context.Background(), re)
+		if test.err == nil {
+			is.NoError(er, "test %d", test.run)
+			is.Equal(test.expected, m.Submatches, "test %d", test.run)
+		} else {
+			is.Equal(ErrExited, er, "test %d", test.run)
+		}
+	}
+}
+
+func TestWaitForOutputAfterExecute(t *testing.T) {
+	is := assert.New(t)
+	re := regexp.MustCompile(`ready (\d+)`)
+	var tests = []struct {
+		run      int
+		cmd      string
+		delay    time.Duration
+		expected []string
+		err      error
+	}{
+		{1, "sh -c 'echo ready 1; sleep 10'", 0, []string{"ready 1", "1"}, nil},
+		{2, "sh -c 'echo ready 2; sleep 10'", 200 * time.Millisecond, []string{"ready 2", "2"}, nil},
+		{3, "sh -c 'sleep 0.2; echo ready 3; sleep 10'", 0, []string{"ready 3", "3"}, nil},
+		{4, "sh -c 'for i in $(seq 100); do echo ready $i; done; sleep 10'", 200 * time.Millisecond, []string{"ready 37", "37"}, nil},
+		{5, "sh -c 'echo starting; exit 1'", 200 * time.Millisecond, nil, ErrExited},
+	}
+
+	for _, test := range tests {
+		p, er := New("wait", test.cmd)
+		is.NoError(er, "test %d", test.run)
+		p.SetProcessGroup()
+
+		is.NoError(p.Execute(context.Background()), "test %d", test.run)
+		time.Sleep(test.delay)
+		c, q := context.WithTimeout(context.Background(), 5*time.Second)
+		m, er := p.WaitForOutput(c, re)
+		q()
+		is.Equal(test.err, er, "test %d", test.run)
+		if test.err == nil {
+			is.Equal(test.expected, m.Submatches, "test %d", test.run)
+		}
+		p.Kill()
+		<-p.Exited()
+	}
+}
@@ -0,0 +1,163 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics collects per-process counters and gauges, labelled by process
+// name, and exposes them in the Prometheus text format. Processes record
+// into it once added with SetMetrics.
+type Metrics struct {
+	mu    sync.Mutex
+	procs map[string]*procMetrics
+}
+
+type procMetrics struct {
+	starts, restarts uint64
+	exits            map[int]uint64
+	running          bool
+	started          time.Time
+	lastExit         time.Time
+	toReady          time.Duration
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{procs: make(map[string]*procMetrics)}
+}
+
+// SetMetrics records the runs of the process in m.
+func (p *Process) SetMetrics(m *Metrics) *Process {
+	p.metrics = m
+	return p
+}
+
+func (m *Metrics) get(name string) *procMetrics {
+	pm, ok := m.procs[name]
+	if !ok {
+		pm = &procMetrics{exits: make(map[int]uint64)}
+		m.procs[name] = pm
+	}
+	return pm
+}
+
+func (m *Metrics) start(name string, restart bool, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pm := m.get(name)
+	pm.starts++
+	if restart {
+		pm.restarts++
+	}
+	pm.running = true
+	pm.started = t
+	pm.toReady = 0
+}
+
+func (m *Metrics) ready(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(name).toReady = d
+}
+
+// exit records r, counted under its Status.
+func (m *Metrics) exit(name string, r *ExitResult, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pm := m.get(name)
+	pm.exits[r.Status()]++
+	pm.running = false
+	pm.lastExit = t
+}
+
+// WriteTo writes every metric to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	m.write(&b, time.Now())
+	return b.WriteTo(w)
+}
+
+func (m *Metrics) write(b *bytes.Buffer, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.procs))
+	for name := range m.procs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	family := func(name, typ, help string, value func(n string, pm *procMetrics)) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, n := range names {
+			value(n, m.procs[n])
+		}
+	}
+	family("gearbox_process_starts_total", "counter", "Number of times the process was started.", func(n string, pm *procMetrics) {
+		fmt.Fprintf(b, "gearbox_process_starts_total{name=\"%s\"} %d\n", escape(n), pm.starts)
+	})
+	family("gearbox_process_restarts_total", "counter", "Number of times the process was started again after a previous run.", func(n string, pm *procMetrics) {
+		fmt.Fprintf(b, "gearbox_process_restarts_total{name=\"%s\"} %d\n", escape(n), pm.restarts)
+	})
+	family("gearbox_process_exits_total", "counter", "Number of process exits by exit code, 128+signal for signals.", func(n string, pm *procMetrics) {
+		codes := make([]int, 0, len(pm.exits))
+		for code := range pm.exits {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(b, "gearbox_process_exits_total{name=\"%s\",code=\"%d\"} %d\n", escape(n), code, pm.exits[code])
+		}
+	})
+	family("gearbox_process_uptime_seconds", "gauge", "Time since the running process was started, 0 if it is not running.", func(n string, pm *procMetrics) {
+		var up float64
+		if pm.running {
+			up = now.Sub(pm.started).Seconds()
+		}
+		fmt.Fprintf(b, "gearbox_process_uptime_seconds{name=\"%s\"} %g\n", escape(n), up)
+	})
+	family("gearbox_process_last_exit_time_seconds", "gauge", "Unix time the process last exited, 0 if it never has.", func(n string, pm *procMetrics) {
+		var t float64
+		if !pm.lastExit.IsZero() {
+			t = float64(pm.lastExit.UnixNano()) / 1e9
+		}
+		fmt.Fprintf(b, "gearbox_process_last_exit_time_seconds{name=\"%s\"} %f\n", escape(n), t)
+	})
+	family("gearbox_process_time_to_ready_seconds", "gauge", "Time the last run took to pass its readiness probe.", func(n string, pm *procMetrics) {
+		fmt.Fprintf(b, "gearbox_process_time_to_ready_seconds{name=\"%s\"} %g\n", escape(n), pm.toReady.Seconds())
+	})
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// ServeMetrics serves m at /metrics on addr, e.g. "127.0.0.1:9100". It
+// blocks like http.ListenAndServe.
+func ServeMetrics(addr string, m *Metrics) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	return http.ListenAndServe(addr, mux)
+}
+
+// WriteTextfile writes m to path for the node_exporter textfile collector.
+// The file is replaced atomically so the collector never reads a partial
+// write; path should end in .prom.
+func (m *Metrics) WriteTextfile(path string) error {
+	var b bytes.Buffer
+	m.write(&b, time.Now())
+	return writeFileAtomic(path, b.Bytes(), 0644)
+}
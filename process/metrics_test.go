@@ -0,0 +1,74 @@
+package process
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestMetrics(t *testing.T) {
+	is := assert.New(t)
+	m := NewMetrics()
+
+	var tests = []struct {
+		run  int
+		name string
+		cmd  string
+	}{
+		{1, "ok", "true"},
+		{2, "ok", "true"},
+		{3, "fail", "sh -c 'exit 3'"},
+		{4, "killed", "sh -c 'kill -9 $$'"},
+	}
+	procs := make(map[string]*Process)
+	for _, test := range tests {
+		p, ok := procs[test.name]
+		if !ok {
+			var er error
+			p, er = New(test.name, test.cmd)
+			is.NoError(er, "test %d", test.run)
+			p.SetMetrics(m)
+			procs[test.name] = p
+		}
+		p.Run(context.Background())
+	}
+
+	var b bytes.Buffer
+	_, er := m.WriteTo(&b)
+	is.NoError(er)
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE gearbox_process_starts_total counter",
+		`gearbox_process_starts_total{name="ok"} 2`,
+		`gearbox_process_restarts_total{name="ok"} 1`,
+		`gearbox_process_restarts_total{name="fail"} 0`,
+		`gearbox_process_exits_total{name="ok",code="0"} 2`,
+		`gearbox_process_exits_total{name="fail",code="3"} 1`,
+		`gearbox_process_exits_total{name="killed",code="137"} 1`,
+		`gearbox_process_uptime_seconds{name="ok"} 0`,
+	} {
+		is.Contains(out, want)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	is.Equal(out, rec.Body.String())
+
+	dir, er := ioutil.TempDir("", "metrics")
+	is.NoError(er)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gearbox.prom")
+	is.NoError(m.WriteTextfile(path))
+	b2, er := ioutil.ReadFile(path)
+	is.NoError(er)
+	is.True(strings.HasPrefix(string(b2), "# HELP gearbox_process_starts_total"))
+	files, _ := ioutil.ReadDir(dir)
+	is.Len(files, 1)
+}
@@ -0,0 +1,97 @@
+package process
+
+import (
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// drainIdle is how long an output pipe may sit empty after the process
+// has exited before it is closed. Descendants that outlive the process
+// keep the write end open, and would otherwise hold up Exited until they
+// exit too.
+var drainIdle = 100 * time.Millisecond
+
+// outPipe is the read end of a process output pipe. It records when a
+// read started blocking, so that a pipe left empty but held open by
+// descendants can be told apart from one whose reader is still busy.
+type outPipe struct {
+	*os.File
+	blocked int64
+	once    sync.Once
+}
+
+// newOutPipe returns the read end of a new pipe and the write end to give
+// to the child.
+func newOutPipe() (*outPipe, *os.File, error) {
+	r, w, er := os.Pipe()
+	if er != nil {
+		return nil, nil, er
+	}
+	return &outPipe{File: r}, w, nil
+}
+
+func (o *outPipe) Read(b []byte) (int, error) {
+	atomic.StoreInt64(&o.blocked, time.Now().UnixNano())
+	n, er := o.File.Read(b)
+	atomic.StoreInt64(&o.blocked, 0)
+	return n, er
+}
+
+// idle reports whether a read has been blocked for at least d.
+func (o *outPipe) idle(d time.Duration) bool {
+	t := atomic.LoadInt64(&o.blocked)
+	return t != 0 && time.Since(time.Unix(0, t)) >= d
+}
+
+func (o *outPipe) Close() error {
+	var er error
+	o.once.Do(func() { er = o.File.Close() })
+	return er
+}
+
+// isClosed reports whether er came from reading a pipe closed by drain.
+func isClosed(er error) bool {
+	pe, ok := er.(*os.PathError)
+	return ok && pe.Err == os.ErrClosed
+}
+
+// drain waits for the output streams of an exited process to finish,
+// closing any pipe that stays idle for drainIdle. Output written after
+// that by descendants is lost.
+func drain(p *Process, streams *sync.WaitGroup, pipes []*outPipe) {
+	done := make(chan struct{})
+	go func() {
+		streams.Wait()
+		close(done)
+	}()
+
+	tick := time.NewTicker(drainIdle / 4)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			for _, o := range pipes {
+				o.Close()
+			}
+			return
+		case <-tick.C:
+			for _, o := range pipes {
+				if o.idle(drainIdle) && o.Close() == nil {
+					log.Printf("[debug] %v output held open by descendants, closing", p)
+				}
+			}
+		}
+	}
+}
+
+func closeFiles(pipes []*outPipe, files []*os.File) {
+	for _, o := range pipes {
+		o.Close()
+	}
+	for _, f := range files {
+		f.Close()
+	}
+}
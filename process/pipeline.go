@@ -0,0 +1,161 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Pipeline runs processes like a shell pipeline, a | b | c. Each stage's
+// stdout is connected to the next stage's stdin by an OS pipe; stderr and
+// the last stage's stdout go to each stage's own writers.
+type Pipeline struct {
+	stages []*Process
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+func NewPipeline(stages ...*Process) *Pipeline {
+	return &Pipeline{stages: stages, done: make(chan struct{})}
+}
+
+// Execute starts every stage. Cancelling ctx, or calling Stop, terminates
+// all of them. Interactive stages cannot be connected by pipes, so they
+// are only allowed in a pipeline of one.
+func (pl *Pipeline) Execute(ctx context.Context) error {
+	pl.mu.Lock()
+	select {
+	case <-pl.done:
+		pl.done = make(chan struct{})
+	default:
+		if pl.cancel != nil {
+			pl.mu.Unlock()
+			return ErrRunning
+		}
+	}
+	done := pl.done
+	pl.mu.Unlock()
+
+	if er := pl.execute(ctx, done); er != nil {
+		close(done)
+		return er
+	}
+	return nil
+}
+
+func (pl *Pipeline) execute(ctx context.Context, done chan struct{}) error {
+	if len(pl.stages) < 1 {
+		return errors.New("empty pipeline")
+	}
+	if len(pl.stages) > 1 {
+		for i, p := range pl.stages {
+			if p.tty {
+				return fmt.Errorf("pipeline stage %d (%s): interactive stages cannot be piped", i, p.name)
+			}
+		}
+	}
+
+	var (
+		c, cancel = context.WithCancel(ctx)
+		files     = make([]*os.File, 0, 2*len(pl.stages))
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+		for _, p := range pl.stages {
+			p.pipeIn, p.pipeOut = nil, nil
+		}
+	}()
+
+	for i := 0; i < len(pl.stages)-1; i++ {
+		r, w, er := os.Pipe()
+		if er != nil {
+			cancel()
+			return er
+		}
+		files = append(files, r, w)
+		pl.stages[i].pipeOut = w
+		pl.stages[i+1].pipeIn = r
+	}
+
+	for i, p := range pl.stages {
+		if er := p.Execute(c); er != nil {
+			cancel()
+			for _, f := range files {
+				f.Close()
+			}
+			for _, started := range pl.stages[:i] {
+				<-started.Exited()
+			}
+			return fmt.Errorf("pipeline stage %d (%s): %v", i, p.name, er)
+		}
+	}
+
+	pl.mu.Lock()
+	pl.cancel = cancel
+	pl.mu.Unlock()
+
+	go func() {
+		for _, p := range pl.stages {
+			<-p.Exited()
+		}
+		cancel()
+		close(done)
+	}()
+	return nil
+}
+
+// Run executes the pipeline and waits for every stage to exit.
+func (pl *Pipeline) Run(ctx context.Context) ([]*ExitResult, error) {
+	if er := pl.Execute(ctx); er != nil {
+		return nil, er
+	}
+	<-pl.Exited()
+	return pl.Results(), pl.Error()
+}
+
+func (pl *Pipeline) Stages() []*Process {
+	return pl.stages
+}
+
+// Exited is closed once every stage has exited, or when Execute fails. It
+// can be waited on before Execute is called.
+func (pl *Pipeline) Exited() <-chan struct{} {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.done
+}
+
+func (pl *Pipeline) Stop() {
+	pl.mu.Lock()
+	cancel := pl.cancel
+	pl.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Results returns each stage's ExitResult, in pipeline order.
+func (pl *Pipeline) Results() []*ExitResult {
+	results := make([]*ExitResult, len(pl.stages))
+	for i, p := range pl.stages {
+		results[i] = p.Result()
+	}
+	return results
+}
+
+// Error reports the pipeline's status like bash's pipefail: the error of
+// the last stage that failed, or nil if every stage succeeded.
+func (pl *Pipeline) Error() error {
+	for i := len(pl.stages) - 1; i >= 0; i-- {
+		if er := pl.stages[i].Error(); er != nil {
+			return fmt.Errorf("pipeline stage %d (%s): %v", i, pl.stages[i].name, er)
+		}
+	}
+	return nil
+}
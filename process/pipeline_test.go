@@ -0,0 +1,83 @@
+package process
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestPipeline(t *testing.T) {
+	is := assert.New(t)
+	var out bytes.Buffer
+	a, _ := New("a", `printf 'b\na\nc\n'`)
+	b, _ := New("b", "sort")
+	c, _ := New("c", "head -n 2", &out)
+	c.RawOutput()
+
+	results, er := NewPipeline(a, b, c).Run(context.Background())
+	is.NoError(er)
+	is.Len(results, 3)
+	is.Equal("a\nb\n", out.String())
+}
+
+func TestPipelineFail(t *testing.T) {
+	is := assert.New(t)
+	a, _ := New("a", "false")
+	b, _ := New("b", "cat")
+
+	results, er := NewPipeline(a, b).Run(context.Background())
+	if is.Error(er) {
+		is.Contains(er.Error(), "stage 0 (a)")
+	}
+	is.Equal(1, results[0].ExitCode)
+	is.Equal(0, results[1].ExitCode)
+}
+
+func TestPipelineCancel(t *testing.T) {
+	is := assert.New(t)
+	a, _ := New("a", "sleep 10")
+	b, _ := New("b", "cat")
+
+	c, q := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer q()
+	start := time.Now()
+	results, er := NewPipeline(a, b).Run(c)
+	is.Error(er)
+	is.True(time.Since(start) < 5*time.Second)
+	is.True(results[0].TimedOut)
+}
+
+func TestPipelineInteractive(t *testing.T) {
+	is := assert.New(t)
+	a, _ := New("a", "echo a")
+	b, _ := New("b", "cat")
+	b.MakeInteractive()
+
+	pl := NewPipeline(a, b)
+	if er := pl.Execute(context.Background()); is.Error(er) {
+		is.Contains(er.Error(), "stage 1 (b)")
+	}
+	select {
+	case <-pl.Exited():
+	default:
+		t.Fatal("Exited should be closed when Execute fails")
+	}
+}
+
+func TestPipelineExitedBeforeExecute(t *testing.T) {
+	is := assert.New(t)
+	a, _ := New("a", "true")
+	pl := NewPipeline(a)
+
+	exited := pl.Exited()
+	is.NotNil(exited)
+	is.NoError(pl.Execute(context.Background()))
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not exit")
+	}
+}
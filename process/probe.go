@@ -0,0 +1,199 @@
+package process
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Probe checks some aspect of a running process, returning nil on success.
+// Check must give up when ctx is done.
+type Probe interface {
+	Check(ctx context.Context) error
+}
+
+type ProbeFunc func(ctx context.Context) error
+
+func (f ProbeFunc) Check(ctx context.Context) error { return f(ctx) }
+
+// ExecProbe succeeds when cmd exits 0.
+func ExecProbe(cmd string) Probe {
+	argv, er := Split(cmd)
+	return ProbeFunc(func(ctx context.Context) error {
+		if er != nil {
+			return er
+		}
+		p, er := NewArgv("probe", argv)
+		if er != nil {
+			return er
+		}
+		p.SetStopSignal(syscall.SIGKILL, time.Second)
+		if er := p.Execute(ctx); er != nil {
+			return er
+		}
+		<-p.Exited()
+		if p.Result().TimedOut {
+			return fmt.Errorf("probe %q timed out", cmd)
+		}
+		return p.Error()
+	})
+}
+
+// TCPProbe succeeds when a TCP connection to addr can be established.
+func TCPProbe(addr string) Probe {
+	return ProbeFunc(func(ctx context.Context) error {
+		d := &net.Dialer{}
+		if dl, ok := ctx.Deadline(); ok {
+			d.Deadline = dl
+		}
+		conn, er := d.Dial("tcp", addr)
+		if er != nil {
+			return er
+		}
+		return conn.Close()
+	})
+}
+
+// HTTPProbe succeeds when a GET of path on localhost:port returns a 2xx or
+// 3xx status.
+func HTTPProbe(port int, path string) Probe {
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
+	return ProbeFunc(func(ctx context.Context) error {
+		resp, er := ctxhttp.Get(ctx, nil, url)
+		if er != nil {
+			return er
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return nil
+	})
+}
+
+// FileProbe succeeds when path exists.
+func FileProbe(path string) Probe {
+	return ProbeFunc(func(ctx context.Context) error {
+		_, er := os.Stat(path)
+		return er
+	})
+}
+
+// ProbeConfig controls how often a Probe runs. A probe is considered
+// failing after FailureThreshold consecutive failures and passing again
+// after a single success.
+type ProbeConfig struct {
+	Probe            Probe
+	InitialDelay     time.Duration
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int
+}
+
+const (
+	DefaultProbeInterval  = 10 * time.Second
+	DefaultProbeTimeout   = time.Second
+	DefaultProbeThreshold = 3
+)
+
+// probeState tracks one probe over a single run. passed is closed the
+// first time the probe succeeds.
+type probeState struct {
+	sync.Mutex
+	passing bool
+	passed  chan struct{}
+}
+
+func newProbeState(pc *ProbeConfig) *probeState {
+	st := &probeState{passed: make(chan struct{})}
+	if pc == nil {
+		st.pass()
+	}
+	return st
+}
+
+func (s *probeState) pass() {
+	s.Lock()
+	defer s.Unlock()
+	if !s.passing {
+		s.passing = true
+		select {
+		case <-s.passed:
+		default:
+			close(s.passed)
+		}
+	}
+}
+
+func (s *probeState) fail() {
+	s.Lock()
+	defer s.Unlock()
+	s.passing = false
+}
+
+func (s *probeState) ok() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.passing
+}
+
+func runProbe(p *Process, c context.Context, kind string, pc *ProbeConfig, st *probeState, failed func()) {
+	var (
+		interval  = pc.Interval
+		timeout   = pc.Timeout
+		threshold = pc.FailureThreshold
+		failures  int
+	)
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	if threshold < 1 {
+		threshold = DefaultProbeThreshold
+	}
+
+	select {
+	case <-c.Done():
+		return
+	case <-time.After(pc.InitialDelay):
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		pctx, q := context.WithTimeout(c, timeout)
+		er := pc.Probe.Check(pctx)
+		q()
+
+		select {
+		case <-c.Done():
+			return
+		default:
+		}
+		if er == nil {
+			failures = 0
+			st.pass()
+		} else if failures++; failures == threshold {
+			log.Printf("[warn] %v %s probe failed %d times: %v", p, kind, failures, er)
+			st.fail()
+			if failed != nil {
+				failed()
+			}
+		}
+
+		select {
+		case <-c.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
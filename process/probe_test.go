@@ -0,0 +1,60 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestReadinessProbe(t *testing.T) {
+	is := assert.New(t)
+	dir, er := ioutil.TempDir("", "probe")
+	is.NoError(er)
+	defer os.RemoveAll(dir)
+
+	flag := filepath.Join(dir, "ready")
+	p, er := NewArgv("ready", []string{"sh", "-c", "sleep 0.1; touch " + flag + "; sleep 10"})
+	is.NoError(er)
+	p.SetReadinessProbe(ProbeConfig{Probe: FileProbe(flag), Interval: 10 * time.Millisecond})
+
+	is.NoError(p.Execute(context.Background()))
+	defer p.Kill()
+	is.False(p.IsReady())
+	select {
+	case <-p.Ready():
+		is.True(p.IsReady())
+	case <-time.After(5 * time.Second):
+		t.Fatal("process never became ready")
+	}
+	select {
+	case <-p.Healthy():
+	default:
+		t.Fatal("process without liveness probe should be healthy")
+	}
+}
+
+func TestLivenessProbeRestart(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("sick", "sleep 10")
+	is.NoError(er)
+	p.SetLivenessProbe(ProbeConfig{
+		Probe:            ExecProbe("false"),
+		Interval:         10 * time.Millisecond,
+		FailureThreshold: 2,
+	}, true)
+
+	is.NoError(p.Execute(context.Background()))
+	select {
+	case <-p.Exited():
+	case <-time.After(5 * time.Second):
+		p.Kill()
+		t.Fatal("unhealthy process was not stopped")
+	}
+	is.True(p.Result().Unhealthy)
+	is.False(p.IsHealthy())
+}
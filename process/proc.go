@@ -0,0 +1,118 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var procRoot = "/proc"
+
+type procStat struct {
+	Pid       int
+	PPid      int
+	State     byte
+	Pgrp      int
+	Session   int
+	StartTime uint64
+}
+
+// readStat parses /proc/<pid>/stat. The command name is skipped since it
+// may itself contain spaces and parentheses.
+func readStat(pid int) (*procStat, error) {
+	b, er := ioutil.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if er != nil {
+		return nil, er
+	}
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return nil, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	// fields[0] is stat field 3 (state); starttime is field 22.
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	st := &procStat{Pid: pid, State: fields[0][0]}
+	if st.PPid, er = strconv.Atoi(fields[1]); er != nil {
+		return nil, er
+	}
+	if st.Pgrp, er = strconv.Atoi(fields[2]); er != nil {
+		return nil, er
+	}
+	if st.Session, er = strconv.Atoi(fields[3]); er != nil {
+		return nil, er
+	}
+	if st.StartTime, er = strconv.ParseUint(fields[19], 10, 64); er != nil {
+		return nil, er
+	}
+	return st, nil
+}
+
+// listProcs returns the stat of every process currently visible in /proc.
+// Processes that exit while being read are skipped.
+func listProcs() ([]*procStat, error) {
+	d, er := os.Open(procRoot)
+	if er != nil {
+		return nil, er
+	}
+	defer d.Close()
+
+	names, er := d.Readdirnames(-1)
+	if er != nil {
+		return nil, er
+	}
+	procs := make([]*procStat, 0, len(names))
+	for _, name := range names {
+		pid, er := strconv.Atoi(name)
+		if er != nil {
+			continue
+		}
+		if st, er := readStat(pid); er == nil {
+			procs = append(procs, st)
+		}
+	}
+	return procs, nil
+}
+
+// Descendants returns the pids of every process descended from pid, found
+// by walking /proc. Parents are listed before their children.
+func Descendants(pid int) ([]int, error) {
+	procs, er := listProcs()
+	if er != nil {
+		return nil, er
+	}
+	children := make(map[int][]int)
+	for _, st := range procs {
+		children[st.PPid] = append(children[st.PPid], st.Pid)
+	}
+
+	var (
+		found = make([]int, 0)
+		queue = children[pid]
+	)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		found = append(found, next)
+		queue = append(queue, children[next]...)
+	}
+	return found, nil
+}
+
+// signalAll sends sig to each of pids, ignoring processes that have
+// already gone away.
+func signalAll(pids []int, sig syscall.Signal) error {
+	for _, pid := range pids {
+		if er := syscall.Kill(pid, sig); er != nil && er != syscall.ESRCH {
+			return er
+		}
+	}
+	return nil
+}
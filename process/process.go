@@ -5,36 +5,95 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
-	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"golang.org/x/net/context"
 )
 
+// StopStep is one stage of a stop sequence: Signal is sent to the process,
+// which is then given Wait to exit before the next step runs.
+type StopStep struct {
+	Signal os.Signal
+	Wait   time.Duration
+}
+
+// DefaultStopSequence is used by Term when no stop sequence has been set.
+// The process is always killed if it outlives the last step.
+var DefaultStopSequence = []StopStep{
+	{Signal: syscall.SIGTERM, Wait: 10 * time.Second},
+}
+
 type Process struct {
 	*exec.Cmd
-	attr           *syscall.SysProcAttr
+	cred           *syscall.Credential
+	user           string
+	loginEnv       bool
 	name, bin, dir string
-	rawOut, tty    bool
+	tty            bool
+	pgroup, setsid bool
+	killTree       bool
 	args, env      []string
 	c              context.Context
 	out            []io.Writer
+	stdoutW        []io.Writer
+	stderrW        []io.Writer
+	format         Formatter
+	lines          lineHub
 	stdin          io.Reader
+	exp            *expecter
+	capOut, capErr io.Writer
+	streamEr       error
+	pipeIn         *os.File
+	pipeOut        *os.File
+	pty            *ptySession
+	readiness      *ProbeConfig
+	liveness       *ProbeConfig
+	restartSick    bool
+	ready, healthy *probeState
+	watch          *WatchConfig
+	metrics        *Metrics
+	runs           int
+	rlimits        []Rlimit
+	cgroup         *Cgroup
+	cg             *cgroupRun
+	outTail        *ringBuffer
+	errTail        *ringBuffer
 	stopC          chan struct{}
+	stopSeq        []StopStep
+	fwd            forwarder
 	er             error
+	mu             sync.Mutex
+	wmu            sync.Mutex
+	state          State
+	states         stateHub
+	started        time.Time
+	reason         stopReason
+	result         *ExitResult
 }
 
+// New parses cmd with Split and returns a Process for it.
 func New(name, cmd string, out ...io.Writer) (*Process, error) {
-	fields := strings.Fields(cmd)
-	if len(fields) < 1 {
+	argv, er := Split(cmd)
+	if er != nil {
+		return nil, er
+	}
+	return NewArgv(name, argv, out...)
+}
+
+// NewArgv returns a Process running argv[0] with the remaining arguments
+// passed through untouched.
+func NewArgv(name string, argv []string, out ...io.Writer) (*Process, error) {
+	if len(argv) < 1 {
 		return nil, errors.New("Bad command")
 	}
 
-	bin, er := exec.LookPath(fields[0])
+	bin, er := exec.LookPath(argv[0])
 	if er != nil {
 		return nil, er
 	}
@@ -42,10 +101,10 @@ func New(name, cmd string, out ...io.Writer) (*Process, error) {
 	return &Process{
 		name:   name,
 		bin:    bin,
-		args:   fields[1:],
+		args:   append([]string{}, argv[1:]...),
 		tty:    false,
 		out:    out,
-		rawOut: false,
+		format: DefaultFormatter,
 		stdin:  nil,
 		er:     nil,
 	}, nil
@@ -67,11 +126,59 @@ func (p *Process) AddWriter(w io.Writer) *Process {
 	return p
 }
 
+// AddStdoutWriter adds a writer that receives only the process's stdout.
+func (p *Process) AddStdoutWriter(w io.Writer) *Process {
+	p.stdoutW = append(p.stdoutW, w)
+	return p
+}
+
+// AddStderrWriter adds a writer that receives only the process's stderr.
+// An interactive process has a single pty for both, so stdout and stderr
+// writers alike receive all of its output.
+func (p *Process) AddStderrWriter(w io.Writer) *Process {
+	p.stderrW = append(p.stderrW, w)
+	return p
+}
+
+// SetFormatter sets how lines are rendered for the added writers. The
+// default is DefaultFormatter.
+func (p *Process) SetFormatter(f Formatter) *Process {
+	p.format = f
+	return p
+}
+
+// Subscribe returns a Subscription to every line the process writes to
+// stdout or stderr, across restarts, until it is closed. The output of an
+// interactive process arrives as Stdout lines. Lines are dropped while
+// the buffer is full.
+func (p *Process) Subscribe(buffer int) *Subscription {
+	return p.lines.subscribe(buffer)
+}
+
 func (p *Process) SetStdin(r io.Reader) *Process {
 	p.stdin = r
 	return p
 }
 
+// KeepTail keeps the last lines lines, and at most bytes bytes, of stdout
+// and stderr separately. A zero limit is unlimited; both zero disables it.
+// The captured lines are available from Tail and are attached to Error
+// when the process fails.
+func (p *Process) KeepTail(lines, bytes int) *Process {
+	if lines < 1 && bytes < 1 {
+		p.outTail, p.errTail = nil, nil
+		return p
+	}
+	p.outTail = newRingBuffer(lines, bytes)
+	p.errTail = newRingBuffer(lines, bytes)
+	return p
+}
+
+// Tail returns the lines captured by KeepTail during the last run.
+func (p *Process) Tail() (stdout, stderr []string) {
+	return p.outTail.snapshot(), p.errTail.snapshot()
+}
+
 func (p *Process) SetDir(dir string) *Process {
 	p.dir = dir
 	return p
@@ -82,206 +189,716 @@ func (p *Process) SetEnv(env []string) *Process {
 	return p
 }
 
+// SetUser runs the process with the given uid and gid and no supplementary
+// groups. See SetUserName to run as a named user.
 func (p *Process) SetUser(uid, gid uint32) *Process {
-	p.attr = &syscall.SysProcAttr{
-		Credential: &syscall.Credential{
-			Uid: uid,
-			Gid: gid,
-		},
+	p.cred = &syscall.Credential{Uid: uid, Gid: gid}
+	p.user = ""
+	return p
+}
+
+// SetStopSignal makes Term send sig and wait up to grace for the process to
+// exit before killing it.
+func (p *Process) SetStopSignal(sig os.Signal, grace time.Duration) *Process {
+	return p.SetStopSequence(StopStep{Signal: sig, Wait: grace})
+}
+
+// SetStopSequence sets the signals Term escalates through, e.g. SIGTERM,
+// then SIGINT, before finally killing the process.
+func (p *Process) SetStopSequence(steps ...StopStep) *Process {
+	p.stopSeq = steps
+	return p
+}
+
+// SetProcessGroup starts the process in its own process group so that
+// Signal, Term and Kill reach every process in that group.
+func (p *Process) SetProcessGroup() *Process {
+	p.pgroup = true
+	return p
+}
+
+// SetSession starts the process as the leader of a new session, which also
+// makes it the leader of a new process group.
+func (p *Process) SetSession() *Process {
+	p.setsid = true
+	return p
+}
+
+// SetKillTree makes Signal, Term and Kill also signal every descendant of
+// the process found in /proc, including ones that left its process group.
+func (p *Process) SetKillTree() *Process {
+	p.killTree = true
+	return p
+}
+
+// SetReadinessProbe sets the probe that decides when the process is ready.
+func (p *Process) SetReadinessProbe(pc ProbeConfig) *Process {
+	p.readiness = &pc
+	return p
+}
+
+// SetLivenessProbe sets the probe that decides whether the process is
+// healthy. If restart is set, a process whose probe fails is terminated so
+// that ExecuteAndRestart or a Supervisor starts it again.
+func (p *Process) SetLivenessProbe(pc ProbeConfig, restart bool) *Process {
+	p.liveness = &pc
+	p.restartSick = restart
+	return p
+}
+
+// Ready is closed once the readiness probe first passes in the current
+// run, or as soon as the process starts if it has none.
+func (p *Process) Ready() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ready == nil {
+		return nil
 	}
+	return p.ready.passed
+}
+
+// Healthy is closed once the liveness probe first passes in the current
+// run, or as soon as the process starts if it has none.
+func (p *Process) Healthy() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.healthy == nil {
+		return nil
+	}
+	return p.healthy.passed
+}
+
+func (p *Process) IsReady() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ready != nil && p.ready.ok()
+}
+
+func (p *Process) IsHealthy() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.healthy != nil && p.healthy.ok()
+}
+
+// ForwardSignals relays sigs received by this process to the child, or to
+// its process group, while it runs. Under ExecuteAndRestart or a
+// Supervisor the handlers stay installed between runs, and sigs received
+// then are dropped.
+func (p *Process) ForwardSignals(sigs ...os.Signal) *Process {
+	p.fwd.add(sigs...)
+	return p
+}
+
+// MapSignal forwards from to the child as to, e.g. SIGHUP as SIGUSR1.
+func (p *Process) MapSignal(from, to os.Signal) *Process {
+	p.fwd.mapSignal(from, to)
 	return p
 }
 
 func (p *Process) Pid() int {
-	if p.Cmd != nil && p.Cmd.Process != nil {
-		return p.Process.Pid
+	if proc := p.osProcess(); proc != nil {
+		return proc.Pid
 	}
 	return -1
 }
 
+// osProcess returns the running os.Process, if the process was started.
+func (p *Process) osProcess() *os.Process {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Cmd == nil {
+		return nil
+	}
+	return p.Cmd.Process
+}
+
+// Exited is closed when the last run of the process has exited. It is
+// already closed if the process was never started or failed to start.
 func (p *Process) Exited() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.c == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
 	return p.c.Done()
 }
 
+// Result reports how the last run ended. It is nil until Exited fires.
+func (p *Process) Result() *ExitResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.result
+}
+
+// Execute starts the process and returns once it is running. It fails with
+// ErrRunning if the process has not exited since it was last started.
 func (p *Process) Execute(ctx context.Context) error {
-	p.stopC = make(chan struct{}, 1)
-	p.Cmd = exec.Command(p.bin, p.args...)
-	if p.attr != nil {
-		p.Cmd.SysProcAttr = p.attr
+	p.mu.Lock()
+	switch p.state {
+	case Starting, Running, Stopping:
+		p.mu.Unlock()
+		return ErrRunning
 	}
-	if p.dir != "" {
-		p.Cmd.Dir = p.dir
+	// A Stop while restarting also applies to the next run.
+	if p.state != Restarting || p.stopC == nil {
+		p.stopC = make(chan struct{})
+	}
+	p.setState(Starting)
+	p.mu.Unlock()
+
+	if er := p.execute(ctx); er != nil {
+		p.mu.Lock()
+		p.er = er
+		p.setState(Failed)
+		p.mu.Unlock()
+		return er
 	}
-	if len(p.env) > 0 {
-		p.Cmd.Env = p.env
+	return nil
+}
+
+func (p *Process) execute(ctx context.Context) error {
+	cmd, er := p.command()
+	if er != nil {
+		return er
 	}
 
 	c, cancel := context.WithCancel(context.Background())
+	p.mu.Lock()
+	p.Cmd = cmd
 	p.c = c
-
-	if p.out != nil {
-		sto, er := p.StdoutPipe()
+	stop := p.stopC
+	p.mu.Unlock()
+
+	var (
+		streams  sync.WaitGroup
+		sto, ste *outPipe
+		pipes    []*outPipe
+		ends     []*os.File
+		stdin    *os.File
+	)
+	p.pty = nil
+	if p.tty {
+		s, er := openPty(p)
 		if er != nil {
 			cancel()
 			return er
 		}
-		ste, er := p.StderrPipe()
+		p.pty = s
+		if p.exp != nil {
+			p.exp.reset(s.ptmx, true)
+		}
+	} else {
+		// The output pipes are our own rather than exec.Cmd's, so that
+		// wait can reap the process without first reading them to EOF.
+		if p.pipeOut != nil {
+			p.Cmd.Stdout = p.pipeOut
+		} else {
+			r, w, er := newOutPipe()
+			if er != nil {
+				cancel()
+				return er
+			}
+			sto, p.Cmd.Stdout = r, w
+			pipes, ends = append(pipes, r), append(ends, w)
+		}
+		r, w, er := newOutPipe()
 		if er != nil {
+			closeFiles(pipes, ends)
 			cancel()
 			return er
 		}
+		ste, p.Cmd.Stderr = r, w
+		pipes, ends = append(pipes, r), append(ends, w)
+		if p.outTail != nil {
+			p.outTail.reset()
+			p.errTail.reset()
+		}
 
-		go stream(p, sto)
-		go stream(p, ste)
-	} else {
-		p.Stdout = nil
-		p.Stderr = nil
+		// Like the output pipes, stdin's is our own, so that the Cmd can
+		// be started again if the first attempt fails.
+		if p.pipeIn != nil {
+			p.Cmd.Stdin = p.pipeIn
+		} else if p.exp != nil || p.stdin != nil {
+			r, w, er := os.Pipe()
+			if er != nil {
+				closeFiles(pipes, ends)
+				cancel()
+				return er
+			}
+			p.Cmd.Stdin, stdin = r, w
+			ends = append(ends, r)
+			if p.exp != nil {
+				p.exp.reset(w, false)
+			} else {
+				go toStdin(p, w)
+			}
+		}
 	}
 
-	if p.tty {
-		p.Stdin = os.Stdin
-	} else if p.stdin != nil {
-		sti, er := p.StdinPipe()
+	p.mu.Lock()
+	p.reason = notStopped
+	p.streamEr = nil
+	p.result = nil
+	p.started = time.Now()
+	p.ready = newProbeState(p.readiness)
+	p.healthy = newProbeState(p.liveness)
+	p.mu.Unlock()
+
+	p.cg = nil
+	cloned := false
+	if p.cgroup != nil {
+		g, er := createCgroup(p.cgroup, p.name)
 		if er != nil {
-			cancel()
-			return er
+			log.Printf("[warn] %v running without cgroup: %v", p, er)
+		}
+		p.cg = g
+		if g != nil {
+			cloned = useCgroup(p.Cmd.SysProcAttr, g)
 		}
-		go toStdin(p, sti)
 	}
 
-	if er := p.Start(); er != nil {
+	reap.RLock()
+	p.mu.Lock()
+	er = p.Start()
+	if er != nil && cloned && cloneUnsupported(er) {
+		log.Printf("[warn] %s cannot be started in its cgroup, moving it there once started: %v", p.name, er)
+		p.Cmd, cloned = restartCmd(p.Cmd), false
+		er = p.Start()
+	}
+	closeFiles(nil, ends)
+	if er != nil {
+		p.mu.Unlock()
+		reap.RUnlock()
+		closeFiles(pipes, []*os.File{stdin})
+		if p.pty != nil {
+			p.pty.tty.Close()
+			p.pty.ptmx.Close()
+			p.pty.stopR.Close()
+			p.pty.stopW.Close()
+		}
+		if p.cg != nil {
+			p.cg.remove()
+		}
 		cancel()
 		return er
 	}
+	if p.cg != nil && !cloned {
+		if er := p.cg.add(p.Process.Pid); er != nil {
+			log.Printf("[warn] %s(pid=%d) running without cgroup: %v", p.name, p.Process.Pid, er)
+		}
+	}
+	p.setState(Running)
+	p.mu.Unlock()
+	reap.manage(p.Process.Pid)
+	reap.RUnlock()
+	p.lines.begin()
+	if p.pty != nil {
+		p.pty.attach(p)
+	} else {
+		// Output and CombinedOutput capture the raw bytes, before they are
+		// split into lines.
+		var stdout, stderr io.Reader = sto, ste
+		if p.capOut != nil {
+			stdout = io.TeeReader(stdout, p.capOut)
+		}
+		if p.capErr != nil {
+			stderr = io.TeeReader(stderr, p.capErr)
+		}
+		if p.exp != nil {
+			stdout, stderr = io.TeeReader(stdout, p.exp), io.TeeReader(stderr, p.exp)
+		}
+		if sto != nil {
+			streams.Add(1)
+			go stream(p, stdout, Stdout, &streams)
+		}
+		streams.Add(1)
+		go stream(p, stderr, Stderr, &streams)
+	}
+
+	if p.metrics != nil {
+		p.metrics.start(p.name, p.runs > 0, p.started)
+		go readyMetric(p, c, p.ready.passed, p.started)
+	}
+	p.runs++
 
-	go listen(p, ctx)
-	go wait(p, cancel)
+	p.fwd.start(func(sig os.Signal) {
+		log.Printf("[info] forwarding %v to %v", sig, p)
+		p.Signal(sig)
+	})
+
+	if p.readiness != nil {
+		go runProbe(p, c, "readiness", p.readiness, p.ready, nil)
+	}
+	if p.liveness != nil {
+		go runProbe(p, c, "liveness", p.liveness, p.healthy, p.unhealthy)
+	}
+	if p.watch != nil {
+		go runWatch(p, c, p.watch)
+	}
+
+	go listen(p, ctx, stop)
+	go wait(p, cancel, &streams, pipes, stdin)
 
 	return nil
 }
 
+// command returns a Cmd for the process with its directory, environment,
+// credentials and rlimits applied.
+func (p *Process) command() (*exec.Cmd, error) {
+	cred, env, er := p.credentials()
+	if er != nil {
+		return nil, er
+	}
+	cmd := exec.Command(p.bin, p.args...)
+	cmd.SysProcAttr = p.sysProcAttr()
+	cmd.SysProcAttr.Credential = cred
+	if p.dir != "" {
+		cmd.Dir = p.dir
+	}
+	if env != nil {
+		cmd.Env = env
+	}
+	if er := wrapChild(cmd, p.rlimits); er != nil {
+		return nil, er
+	}
+	return cmd, nil
+}
+
+// restartCmd returns a copy of cmd, which failed to start, that can be
+// started without its cgroup.
+func restartCmd(cmd *exec.Cmd) *exec.Cmd {
+	attr := *cmd.SysProcAttr
+	dropCgroup(&attr)
+	return &exec.Cmd{
+		Path:        cmd.Path,
+		Args:        cmd.Args,
+		Env:         cmd.Env,
+		Dir:         cmd.Dir,
+		Stdin:       cmd.Stdin,
+		Stdout:      cmd.Stdout,
+		Stderr:      cmd.Stderr,
+		ExtraFiles:  cmd.ExtraFiles,
+		SysProcAttr: &attr,
+	}
+}
+
+func (p *Process) sysProcAttr() *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{}
+	switch {
+	case p.tty:
+		attr.Setsid = true
+		attr.Setctty = true
+	case p.setsid:
+		attr.Setsid = true
+	case p.pgroup:
+		attr.Setpgid = true
+	}
+	return attr
+}
+
+// ExecuteAndRestart runs the process again each time it exits, until ctx
+// is done, Stop is called or it fails to start.
 func (p *Process) ExecuteAndRestart(ctx context.Context) {
+	p.fwd.hold()
+	defer p.fwd.release()
 	for {
 		if er := p.Execute(ctx); er != nil {
-			p.er = er
 			return
 		}
 
+		stop := p.stopChan()
 		select {
 		case <-ctx.Done():
 			return
-		case <-p.stopC:
+		case <-stop:
 			return
-		case <-p.c.Done():
+		case <-p.Exited():
 		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		default:
+		}
+		p.transition(Restarting)
 	}
 }
 
 func (p *Process) RawOutput() *Process {
-	p.rawOut = true
-	return p
+	return p.SetFormatter(RawFormatter)
 }
 
+// MakeInteractive runs the process on a pseudo-terminal connected to the
+// parent's stdin and stdout, or to SetStdin and the added writers.
 func (p *Process) MakeInteractive() *Process {
 	p.RawOutput()
 	p.tty = true
 	return p
 }
 
+// Stop terminates the current run and keeps ExecuteAndRestart from
+// starting another. It does nothing if the process was never started or
+// has already been stopped.
 func (p *Process) Stop() {
-	p.stopC <- struct{}{}
-	close(p.stopC)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopC == nil {
+		return
+	}
+	select {
+	case <-p.stopC:
+	default:
+		close(p.stopC)
+	}
+}
+
+func (p *Process) stopChan() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopC
 }
 
 func (p *Process) Release() error {
-	if p.Process != nil {
-		return p.Process.Release()
+	if proc := p.osProcess(); proc != nil {
+		return proc.Release()
 	}
 	return nil
 }
 
+// Dead reports whether the process has exited, or failed to start, and is
+// not being started again.
 func (p *Process) Dead() bool {
-	return p.ProcessState != nil && p.ProcessState.Exited()
+	s := p.State()
+	return s == Exited || s == Failed
 }
 
 func (p *Process) Kill() error {
-	if p.Process != nil {
-		return p.Process.Kill()
-	}
-	return nil
+	return p.Signal(syscall.SIGKILL)
 }
 
 func (p *Process) Signal(sig os.Signal) error {
-	if p.Process != nil {
-		return p.Process.Signal(sig)
+	proc := p.osProcess()
+	if proc == nil {
+		return nil
 	}
-	return nil
+
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return proc.Signal(sig)
+	}
+
+	// Descendants are found before the leader is signalled, since they
+	// are reparented as soon as it exits.
+	var tree []int
+	if p.killTree {
+		var er error
+		if tree, er = Descendants(proc.Pid); er != nil {
+			log.Printf("[warn] %v could not find descendants: %v", p, er)
+		}
+	}
+	er := p.signalLeader(proc, s)
+	if er := signalAll(tree, s); er != nil {
+		log.Printf("[warn] %v could not signal descendants: %v", p, er)
+	}
+	return er
+}
+
+func (p *Process) signalLeader(proc *os.Process, sig syscall.Signal) error {
+	if p.pgroup || p.setsid || p.tty {
+		if er := syscall.Kill(-proc.Pid, sig); er != syscall.ESRCH {
+			return er
+		}
+	}
+	return proc.Signal(sig)
 }
 
 func (p *Process) Term() error {
-	if p.Process != nil {
-		if er := p.Signal(syscall.SIGTERM); er != nil {
+	if p.osProcess() == nil {
+		return nil
+	}
+
+	seq := p.stopSeq
+	if len(seq) < 1 {
+		seq = DefaultStopSequence
+	}
+	for _, step := range seq {
+		select {
+		case <-p.Exited():
+			return nil
+		default:
+		}
+		if er := p.Signal(step.Signal); er != nil {
 			return er
 		}
-		time.Sleep(20 * time.Millisecond)
-		if p.ProcessState == nil {
-			return p.Kill()
+		select {
+		case <-p.Exited():
+			return nil
+		case <-time.After(step.Wait):
 		}
 	}
-	return nil
+	log.Printf("[warn] %v did not stop in time, killing", p)
+	return p.Kill()
 }
 
 func (p *Process) Error() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	return p.er
 }
 
-func stream(p *Process, r io.Reader) {
+func stream(p *Process, r io.Reader, name Stream, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var (
+		pid     = p.Process.Pid
+		tail    = p.outTail
+		writers = append(append([]io.Writer{}, p.out...), p.stdoutW...)
+		format  = p.format
+	)
+	if name == Stderr {
+		tail = p.errTail
+		writers = append(append([]io.Writer{}, p.out...), p.stderrW...)
+	}
+	if format == nil {
+		format = DefaultFormatter
+	}
+
 	s := bufio.NewScanner(r)
-	for {
-		select {
-		case <-p.c.Done():
-			return
-		default:
-			if s.Scan() {
-				txt := s.Text()
-				for _, w := range p.out {
-					if p.rawOut {
-						fmt.Fprintln(w, txt)
-					} else {
-						fmt.Fprintf(w, "[%s] %s\n", p.name, txt)
-					}
-				}
-			} else {
-				return
+	s.Buffer(make([]byte, 4096), maxLine)
+	s.Split(scanLines)
+	for s.Scan() {
+		l := Line{Stream: name, Text: s.Text(), Time: time.Now(), Pid: pid}
+		if tail != nil {
+			tail.add(l.Text)
+		}
+		if len(writers) > 0 {
+			txt := format(p.name, l)
+			// Writers added with AddWriter are shared by both streams.
+			p.wmu.Lock()
+			for _, w := range writers {
+				fmt.Fprintln(w, txt)
 			}
+			p.wmu.Unlock()
+		}
+		p.lines.publish(l)
+	}
+	if er := s.Err(); er != nil && !isClosed(er) {
+		log.Printf("[error] %v %s stream error: %v", p, name, er)
+		p.mu.Lock()
+		if p.streamEr == nil {
+			p.streamEr = fmt.Errorf("reading %s of %s: %v", name, p.name, er)
 		}
+		p.mu.Unlock()
+		io.Copy(ioutil.Discard, r)
 	}
-	if s.Err() != nil {
-		log.Printf("[error] %v stream error: %v", p, s.Err())
+}
+
+// maxLine is the longest line passed to writers and subscribers; longer
+// lines are split.
+const maxLine = 64 * 1024
+
+// scanLines is bufio.ScanLines, except that a line that fills the buffer
+// is returned in pieces rather than failing the scan.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	adv, tok, er := bufio.ScanLines(data, atEOF)
+	if adv == 0 && er == nil && len(data) >= maxLine {
+		return maxLine, data[:maxLine], nil
 	}
+	return adv, tok, er
 }
 
-func listen(p *Process, ctx context.Context) {
+func listen(p *Process, ctx context.Context, stop <-chan struct{}) {
 	select {
-	case <-p.c.Done():
+	case <-p.Exited():
 		return
 	case <-ctx.Done():
-		p.Kill()
-	case <-p.stopC:
+		if ctx.Err() == context.DeadlineExceeded {
+			p.stopping(stoppedByTimeout)
+		} else {
+			p.stopping(stoppedByStop)
+		}
+		p.Term()
+	case <-stop:
+		p.stopping(stoppedByStop)
 		p.Term()
 	}
 }
 
-func wait(p *Process, cancel context.CancelFunc) {
-	p.er = p.Wait()
+func (p *Process) unhealthy() {
+	if p.restartSick {
+		p.stopping(stoppedByProbe)
+		p.Term()
+	}
+}
+
+func (p *Process) stopping(r stopReason) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reason == notStopped {
+		p.reason = r
+	}
+	if p.state == Running {
+		p.setState(Stopping)
+	}
+}
+
+// wait reaps the process and then drains its output streams, without
+// waiting on descendants that still hold the pipes open.
+func wait(p *Process, cancel context.CancelFunc, streams *sync.WaitGroup, pipes []*outPipe, stdin *os.File) {
+	er := p.Wait()
+	if stdin != nil {
+		stdin.Close()
+	}
+	drain(p, streams, pipes)
+	reap.release(p.Process.Pid)
+	p.fwd.stop()
+	if er != nil && p.outTail != nil {
+		stdout, stderr := p.Tail()
+		er = &TailError{Err: er, Stdout: stdout, Stderr: stderr}
+	}
+	if p.pty != nil {
+		p.pty.close()
+	}
+	if p.exp != nil {
+		p.exp.close()
+	}
+	var oom bool
+	if p.cg != nil {
+		oom = p.cg.oomKilled()
+		if er := p.cg.remove(); er != nil {
+			log.Printf("[warn] %v could not remove cgroup: %v", p, er)
+		}
+	}
+
+	p.mu.Lock()
+	if er == nil {
+		er = p.streamEr
+	}
+	p.er = er
+	p.result = newExitResult(p.ProcessState, p.started, p.reason)
+	p.result.OOMKilled = oom
+	r := p.result
+	p.setState(Exited)
+	p.mu.Unlock()
+	if p.metrics != nil {
+		p.metrics.exit(p.name, r, time.Now())
+	}
+	p.lines.end()
 	cancel()
 }
 
-func toStdin(p *Process, dst io.Writer) {
+func readyMetric(p *Process, c context.Context, ready <-chan struct{}, started time.Time) {
 	select {
-	case <-p.c.Done():
-		return
-	default:
-		io.Copy(dst, p.stdin)
+	case <-ready:
+		p.metrics.ready(p.name, time.Since(started))
+	case <-c.Done():
 	}
 }
+
+func toStdin(p *Process, dst io.WriteCloser) {
+	io.Copy(dst, p.stdin)
+	dst.Close()
+}
@@ -0,0 +1,281 @@
+package process
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestMain(m *testing.M) {
+	ChildInit()
+	os.Exit(m.Run())
+}
+
+func TestTermEscalates(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("stubborn", "sleep 10")
+	is.NoError(er)
+	p.SetStopSequence(
+		StopStep{Signal: syscall.SIGCONT, Wait: 50 * time.Millisecond},
+		StopStep{Signal: syscall.SIGWINCH, Wait: 50 * time.Millisecond},
+	)
+
+	is.NoError(p.Execute(context.Background()))
+	start := time.Now()
+	is.NoError(p.Term())
+	<-p.Exited()
+	is.True(time.Since(start) >= 100*time.Millisecond)
+	is.Error(p.Error())
+}
+
+func TestTermGraceful(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("sleep", "sleep 10")
+	is.NoError(er)
+	p.SetStopSignal(syscall.SIGTERM, 5*time.Second)
+
+	is.NoError(p.Execute(context.Background()))
+	start := time.Now()
+	is.NoError(p.Term())
+	is.True(time.Since(start) < 5*time.Second)
+}
+
+func TestExitResult(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run      int
+		cmd      string
+		timeout  time.Duration
+		code     int
+		signal   syscall.Signal
+		timedOut bool
+	}{
+		{1, "true", time.Second, 0, 0, false},
+		{2, "sh -c 'exit 3'", time.Second, 3, 0, false},
+		{3, "sh -c 'kill -KILL $$'", time.Second, -1, syscall.SIGKILL, false},
+		{4, "sleep 10", 50 * time.Millisecond, -1, syscall.SIGTERM, true},
+	}
+
+	for _, test := range tests {
+		p, er := New("test", test.cmd)
+		is.NoError(er, "test %d", test.run)
+		is.Nil(p.Result(), "test %d", test.run)
+
+		c, q := context.WithTimeout(context.Background(), test.timeout)
+		is.NoError(p.Execute(c), "test %d", test.run)
+		<-p.Exited()
+		q()
+
+		r := p.Result()
+		if is.NotNil(r, "test %d", test.run) {
+			is.Equal(test.code, r.ExitCode, "test %d", test.run)
+			is.Equal(test.signal, r.Signal, "test %d", test.run)
+			is.Equal(test.timedOut, r.TimedOut, "test %d", test.run)
+			is.True(r.Pid > 0, "test %d", test.run)
+		}
+	}
+}
+
+func TestKillProcessGroup(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run   int
+		setup func(*Process) *Process
+	}{
+		{1, (*Process).SetProcessGroup},
+		{2, (*Process).SetSession},
+		{3, (*Process).SetKillTree},
+	}
+
+	for _, test := range tests {
+		p, er := New("group", "sh -c 'sleep 30 & wait'")
+		is.NoError(er, "test %d", test.run)
+		is.NoError(test.setup(p).Execute(context.Background()), "test %d", test.run)
+
+		var kids []int
+		for i := 0; i < 100 && len(kids) < 1; i++ {
+			time.Sleep(10 * time.Millisecond)
+			kids, _ = Descendants(p.Pid())
+		}
+		if !is.Len(kids, 1, "test %d", test.run) {
+			p.Kill()
+			continue
+		}
+
+		is.NoError(p.Kill(), "test %d", test.run)
+		<-p.Exited()
+		is.True(gone(kids[0]), "test %d", test.run)
+	}
+}
+
+func gone(pid int) bool {
+	for i := 0; i < 100; i++ {
+		if st, er := readStat(pid); er != nil || st.State == 'Z' {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestInteractiveAllocatesPty(t *testing.T) {
+	is := assert.New(t)
+	var out, stderr bytes.Buffer
+	p, er := New("tty", "sh -c 'test -t 0 && test -t 1 && echo is-a-tty >&2'")
+	is.NoError(er)
+	p.MakeInteractive().SetStdin(strings.NewReader("")).AddWriter(&out).AddStderrWriter(&stderr)
+
+	is.NoError(p.Execute(context.Background()))
+	<-p.Exited()
+	is.NoError(p.Error())
+	is.Contains(out.String(), "is-a-tty")
+	is.Contains(stderr.String(), "is-a-tty")
+}
+
+func TestInteractiveLeavesStdin(t *testing.T) {
+	is := assert.New(t)
+	r, w, er := os.Pipe()
+	is.NoError(er)
+	defer r.Close()
+	defer w.Close()
+
+	p, er := New("tty", "true")
+	is.NoError(er)
+	p.MakeInteractive().SetStdin(r).AddWriter(ioutil.Discard)
+	is.NoError(p.Execute(context.Background()))
+	<-p.Exited()
+
+	// Input written after the session belongs to whoever reads next.
+	w.WriteString("after\n")
+	read := make(chan string, 1)
+	go func() {
+		b := make([]byte, 16)
+		n, _ := r.Read(b)
+		read <- string(b[:n])
+	}()
+	select {
+	case s := <-read:
+		is.Equal("after\n", s)
+	case <-time.After(time.Second):
+		t.Fatal("input was consumed by the finished session")
+	}
+}
+
+func TestStreamRouting(t *testing.T) {
+	is := assert.New(t)
+	var all, stdout, stderr bytes.Buffer
+	p, er := New("route", "sh -c 'echo out; echo err >&2'", &all)
+	is.NoError(er)
+	p.AddStdoutWriter(&stdout).AddStderrWriter(&stderr)
+	p.SetFormatter(func(name string, l Line) string {
+		return name + " " + string(l.Stream) + " " + l.Text
+	})
+	sub := p.Subscribe(10)
+	defer sub.Close()
+
+	is.NoError(p.Execute(context.Background()))
+	<-p.Exited()
+
+	is.Equal("route stdout out\n", stdout.String())
+	is.Equal("route stderr err\n", stderr.String())
+	is.Contains(all.String(), "route stdout out\n")
+	is.Contains(all.String(), "route stderr err\n")
+
+	seen := map[Stream]string{}
+	for i := 0; i < 2; i++ {
+		l := <-sub.C
+		is.Equal(p.Pid(), l.Pid)
+		seen[l.Stream] = l.Text
+	}
+	is.Equal(map[Stream]string{Stdout: "out", Stderr: "err"}, seen)
+}
+
+func TestSubscriberNeverBlocks(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("chatty", "sh -c 'for i in 1 2 3 4 5; do echo $i; done'")
+	is.NoError(er)
+	sub := p.Subscribe(1)
+	defer sub.Close()
+	// Neither waited on nor closed.
+	p.AwaitOutput(regexp.MustCompile(`never`))
+
+	is.NoError(p.Execute(context.Background()))
+	select {
+	case <-p.Exited():
+	case <-time.After(5 * time.Second):
+		p.Kill()
+		t.Fatal("a subscriber that stopped reading held up Exited")
+	}
+	is.Equal(Exited, p.State())
+	is.Equal("1", (<-sub.C).Text)
+}
+
+func TestRlimits(t *testing.T) {
+	is := assert.New(t)
+	var out bytes.Buffer
+	p, er := New("ulimit", "sh -c 'ulimit -n; ulimit -Hn'", &out)
+	is.NoError(er)
+	p.RawOutput().SetMaxOpenFiles(64)
+
+	is.NoError(p.Execute(context.Background()))
+	<-p.Exited()
+	is.NoError(p.Error())
+	is.Equal("64\n64\n", out.String())
+}
+
+func TestForwardSignals(t *testing.T) {
+	is := assert.New(t)
+	var out bytes.Buffer
+	p, er := New("trap", `sh -c 'trap "exit 7" USR1; echo ready; while true; do sleep 0.01; done'`, &out)
+	is.NoError(er)
+	p.MapSignal(syscall.SIGHUP, syscall.SIGUSR1)
+	sub := p.Subscribe(1)
+	defer sub.Close()
+
+	is.NoError(p.Execute(context.Background()))
+	<-sub.C
+	is.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+	select {
+	case <-p.Exited():
+	case <-time.After(5 * time.Second):
+		p.Kill()
+		t.Fatal("signal was not forwarded")
+	}
+	is.Equal(7, p.Result().ExitCode)
+}
+
+func TestSetUserName(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing user requires root")
+	}
+	nobody, er := user.Lookup("nobody")
+	if er != nil {
+		t.Skipf("no nobody user: %v", er)
+	}
+	is := assert.New(t)
+	p, er := New("nobody", `sh -c 'id -u; echo $HOME $USER $LOGNAME; ps -o pgid= -p $$'`)
+	is.NoError(er)
+	p.SetProcessGroup().SetUserName("nobody", true).RawOutput()
+
+	out, _, er := p.Output(context.Background())
+	is.NoError(er)
+	is.True(p.SysProcAttr.Setpgid)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	is.Len(lines, 3)
+	is.Equal(nobody.Uid, lines[0])
+	is.Equal(nobody.HomeDir+" nobody nobody", lines[1])
+	is.Equal(strconv.Itoa(p.Result().Pid), strings.TrimSpace(lines[2]))
+
+	p.SetUserName("no-such-user", false)
+	is.Error(p.Execute(context.Background()))
+}
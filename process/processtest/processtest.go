@@ -0,0 +1,209 @@
+// Package processtest provides a fake process.Runner that records the
+// commands it is asked to run and answers them from a script.
+package processtest
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/albertrdixon/gearbox/process"
+)
+
+// Call is a single command a Runner was asked to start.
+type Call struct {
+	Name string
+	Argv []string
+}
+
+// Response is the scripted behaviour of a fake command. Output lines are
+// written immediately, then the command "runs" for Delay before exiting
+// with ExitCode. If StartErr is set the command fails to start.
+type Response struct {
+	Stdout   []string
+	Stderr   []string
+	ExitCode int
+	Delay    time.Duration
+	StartErr error
+}
+
+type script struct {
+	prefix []string
+	resp   Response
+}
+
+// Runner is a fake process.Runner. Commands are answered by the first
+// script whose prefix matches their argv, or by Default.
+type Runner struct {
+	mu      sync.Mutex
+	Default Response
+	calls   []Call
+	scripts []script
+	pid     int
+}
+
+func New() *Runner {
+	return &Runner{pid: 1000}
+}
+
+// On scripts resp for every command whose argv starts with prefix.
+func (r *Runner) On(prefix []string, resp Response) *Runner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scripts = append(r.scripts, script{prefix: prefix, resp: resp})
+	return r
+}
+
+// Calls returns every command started so far, in order.
+func (r *Runner) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call{}, r.calls...)
+}
+
+// Argvs returns the argv of every command started so far, in order.
+func (r *Runner) Argvs() [][]string {
+	calls := r.Calls()
+	argvs := make([][]string, 0, len(calls))
+	for _, c := range calls {
+		argvs = append(argvs, c.Argv)
+	}
+	return argvs
+}
+
+func (r *Runner) Run(ctx context.Context, name string, argv []string, out ...io.Writer) (*process.ExitResult, error) {
+	h, er := r.Start(ctx, name, argv, out...)
+	if er != nil {
+		return nil, er
+	}
+	<-h.Exited()
+	res := h.Result()
+	if res.TimedOut {
+		return res, &process.TimeoutError{Name: name, Duration: res.Duration, Err: h.Error()}
+	}
+	return res, h.Error()
+}
+
+func (r *Runner) Start(ctx context.Context, name string, argv []string, out ...io.Writer) (process.Handle, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, Call{Name: name, Argv: append([]string{}, argv...)})
+	resp := r.Default
+	for _, s := range r.scripts {
+		if hasPrefix(argv, s.prefix) {
+			resp = s.resp
+			break
+		}
+	}
+	r.pid++
+	pid := r.pid
+	r.mu.Unlock()
+
+	if resp.StartErr != nil {
+		return nil, resp.StartErr
+	}
+
+	h := &Handle{
+		name: name,
+		pid:  pid,
+		done: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+	write(out, name, pid, process.Stdout, resp.Stdout)
+	write(out, name, pid, process.Stderr, resp.Stderr)
+	go h.run(ctx, resp)
+	return h, nil
+}
+
+func write(out []io.Writer, name string, pid int, stream process.Stream, lines []string) {
+	for _, txt := range lines {
+		l := process.Line{Stream: stream, Text: txt, Time: time.Now(), Pid: pid}
+		for _, w := range out {
+			fmt.Fprintln(w, process.DefaultFormatter(name, l))
+		}
+	}
+}
+
+func hasPrefix(argv, prefix []string) bool {
+	if len(prefix) > len(argv) {
+		return false
+	}
+	for i := range prefix {
+		if argv[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Handle is a fake running command.
+type Handle struct {
+	mu       sync.Mutex
+	name     string
+	pid      int
+	done     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	result   *process.ExitResult
+	er       error
+}
+
+func (h *Handle) run(ctx context.Context, resp Response) {
+	var (
+		start = time.Now()
+		r     = &process.ExitResult{Pid: h.pid, ExitCode: resp.ExitCode}
+	)
+	select {
+	case <-time.After(resp.Delay):
+	case <-ctx.Done():
+		r.TimedOut = ctx.Err() == context.DeadlineExceeded
+		r.Stopped = !r.TimedOut
+		r.ExitCode, r.Signal = -1, syscall.SIGTERM
+	case <-h.stop:
+		r.Stopped = true
+		r.ExitCode, r.Signal = -1, syscall.SIGTERM
+	}
+	r.Duration = time.Since(start)
+
+	h.mu.Lock()
+	h.result = r
+	switch {
+	case r.Signaled():
+		h.er = fmt.Errorf("signal: %v", r.Signal)
+	case r.ExitCode != 0:
+		h.er = fmt.Errorf("exit status %d", r.ExitCode)
+	}
+	h.mu.Unlock()
+	close(h.done)
+}
+
+func (h *Handle) String() string {
+	return fmt.Sprintf("%s(pid=%d)", h.name, h.pid)
+}
+
+func (h *Handle) Pid() int                { return h.pid }
+func (h *Handle) Exited() <-chan struct{} { return h.done }
+
+func (h *Handle) Result() *process.ExitResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.result
+}
+
+func (h *Handle) Error() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.er
+}
+
+func (h *Handle) Stop() {
+	h.stopOnce.Do(func() { close(h.stop) })
+}
+
+func (h *Handle) Kill() error {
+	h.Stop()
+	return nil
+}
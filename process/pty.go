@@ -0,0 +1,186 @@
+package process
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kr/pty"
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/sys/unix"
+)
+
+// ptySession is the pseudo-terminal behind an interactive process. The
+// parent terminal, if stdin is one, is put in raw mode for the lifetime of
+// the session and its window size is kept in sync with the pty.
+type ptySession struct {
+	ptmx, tty *os.File
+	state     *terminal.State
+	winch     chan os.Signal
+	done      chan struct{}
+	// stopW is closed when the session closes, which makes stopR
+	// readable and ends copyInput, which then closes inDone.
+	stopR, stopW *os.File
+	inDone       chan struct{}
+}
+
+func openPty(p *Process) (*ptySession, error) {
+	ptmx, tty, er := pty.Open()
+	if er != nil {
+		return nil, er
+	}
+	stopR, stopW, er := os.Pipe()
+	if er != nil {
+		ptmx.Close()
+		tty.Close()
+		return nil, er
+	}
+	p.Cmd.Stdin = tty
+	p.Cmd.Stdout = tty
+	p.Cmd.Stderr = tty
+	return &ptySession{
+		ptmx:   ptmx,
+		tty:    tty,
+		winch:  make(chan os.Signal, 1),
+		done:   make(chan struct{}),
+		stopR:  stopR,
+		stopW:  stopW,
+		inDone: make(chan struct{}),
+	}, nil
+}
+
+// attach wires the pty to the parent once the child has started.
+func (s *ptySession) attach(p *Process) {
+	s.tty.Close()
+
+	var (
+		in  io.Reader = os.Stdin
+		out io.Writer = os.Stdout
+	)
+	if p.stdin != nil {
+		in = p.stdin
+	}
+	// The pty merges stdout and stderr, so both sets of writers see it.
+	ws := append(append(append([]io.Writer{}, p.out...), p.stdoutW...), p.stderrW...)
+	if len(ws) > 0 {
+		out = io.MultiWriter(ws...)
+	}
+	// Under expect the pty is driven by Send alone and is only shown on
+	// the writers that were added.
+	if p.exp != nil {
+		in = nil
+		if len(ws) < 1 {
+			out = ioutil.Discard
+		}
+		out = io.MultiWriter(out, p.exp)
+	}
+	if p.capOut != nil {
+		out = io.MultiWriter(out, p.capOut)
+	}
+	// Subscribers see the pty's output as lines of stdout.
+	lines := &lineWriter{p: p, pid: p.Process.Pid}
+	out = io.MultiWriter(out, lines)
+
+	fd := int(os.Stdin.Fd())
+	if p.exp == nil && terminal.IsTerminal(fd) {
+		if st, er := terminal.MakeRaw(fd); er == nil {
+			s.state = st
+		} else {
+			log.Printf("[warn] %v could not make terminal raw: %v", p, er)
+		}
+		signal.Notify(s.winch, syscall.SIGWINCH)
+		s.winch <- syscall.SIGWINCH
+		go s.resize(p)
+	}
+
+	// The descriptor of a file is taken now, before the caller can close
+	// it.
+	infd := -1
+	if f, ok := in.(*os.File); ok && f.Fd() < unix.FD_SETSIZE && s.stopR.Fd() < unix.FD_SETSIZE {
+		infd = int(f.Fd())
+	}
+	go s.copyInput(in, infd)
+	go func() {
+		io.Copy(out, s.ptmx)
+		lines.flush()
+		close(s.done)
+	}()
+}
+
+// copyInput copies in to the pty until in ends or the session closes. A
+// file, such as the parent's stdin, is passed with its descriptor fd and
+// only read once select reports it readable, so that nothing is taken
+// from it after the session is over.
+func (s *ptySession) copyInput(in io.Reader, fd int) {
+	defer s.stopR.Close()
+	if fd < 0 {
+		// Other readers cannot be interrupted, so close does not wait.
+		close(s.inDone)
+		if in != nil {
+			io.Copy(s.ptmx, in)
+		}
+		return
+	}
+	defer close(s.inDone)
+
+	var (
+		stop = int(s.stopR.Fd())
+		nfd  = fd + 1
+		buf  = make([]byte, 32*1024)
+	)
+	if stop >= fd {
+		nfd = stop + 1
+	}
+	for {
+		var r unix.FdSet
+		r.Set(fd)
+		r.Set(stop)
+		if _, er := unix.Select(nfd, &r, nil, nil, nil); er == unix.EINTR {
+			continue
+		} else if er != nil || r.IsSet(stop) {
+			return
+		}
+		n, er := in.Read(buf)
+		if n > 0 {
+			if _, er := s.ptmx.Write(buf[:n]); er != nil {
+				return
+			}
+		}
+		if er != nil {
+			return
+		}
+	}
+}
+
+func (s *ptySession) resize(p *Process) {
+	for range s.winch {
+		if er := pty.InheritSize(os.Stdin, s.ptmx); er != nil {
+			log.Printf("[warn] %v could not resize pty: %v", p, er)
+		}
+	}
+}
+
+// close waits briefly for buffered output to drain, then restores the
+// parent terminal and releases the pty. It also waits briefly for input
+// to stop being read, so that the caller may close it.
+func (s *ptySession) close() {
+	select {
+	case <-s.done:
+	case <-time.After(time.Second):
+	}
+	signal.Stop(s.winch)
+	close(s.winch)
+	if s.state != nil {
+		terminal.Restore(int(os.Stdin.Fd()), s.state)
+	}
+	s.stopW.Close()
+	s.ptmx.Close()
+	select {
+	case <-s.inDone:
+	case <-time.After(time.Second):
+	}
+}
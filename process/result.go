@@ -0,0 +1,135 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+type stopReason int
+
+const (
+	notStopped stopReason = iota
+	stoppedByTimeout
+	stoppedByStop
+	stoppedByProbe
+	stoppedByRestart
+)
+
+// ExitResult describes how a process run ended. ExitCode is -1 when the
+// process was terminated by Signal. Unhealthy is set when it was stopped by
+// a failing liveness probe, Restarted when it was stopped by Restart, and
+// OOMKilled when the kernel killed a member of its cgroup for exceeding the
+// memory limit.
+type ExitResult struct {
+	Pid        int
+	ExitCode   int
+	Signal     syscall.Signal
+	TimedOut   bool
+	Stopped    bool
+	Unhealthy  bool
+	Restarted  bool
+	OOMKilled  bool
+	Duration   time.Duration
+	UserTime   time.Duration
+	SystemTime time.Duration
+	MaxRSS     int64
+}
+
+func (r *ExitResult) Success() bool {
+	return r != nil && r.ExitCode == 0
+}
+
+func (r *ExitResult) Signaled() bool {
+	return r != nil && r.Signal != 0
+}
+
+// Status is the exit status a shell would report: the exit code, or 128
+// plus the signal number if the process was killed by a signal.
+func (r *ExitResult) Status() int {
+	if r.Signaled() {
+		return 128 + int(r.Signal)
+	}
+	return r.ExitCode
+}
+
+func (r *ExitResult) String() string {
+	if r == nil {
+		return "<running>"
+	}
+	status := fmt.Sprintf("exit=%d", r.ExitCode)
+	if r.Signaled() {
+		status = fmt.Sprintf("signal=%v", r.Signal)
+	}
+	switch {
+	case r.TimedOut:
+		status += " timed-out"
+	case r.Stopped:
+		status += " stopped"
+	case r.Unhealthy:
+		status += " unhealthy"
+	case r.Restarted:
+		status += " restarted"
+	}
+	if r.OOMKilled {
+		status += " oom-killed"
+	}
+	return fmt.Sprintf("pid=%d %s duration=%v user=%v sys=%v maxrss=%d",
+		r.Pid, status, r.Duration, r.UserTime, r.SystemTime, r.MaxRSS)
+}
+
+// TimeoutError is returned by Run when the process was stopped because its
+// context's deadline passed. Err is the error the process exited with.
+type TimeoutError struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s timed out after %v", e.Name, e.Duration)
+	}
+	return fmt.Sprintf("%s timed out after %v: %v", e.Name, e.Duration, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// IsTimeout reports whether er is, or wraps, a *TimeoutError.
+func IsTimeout(er error) bool {
+	var te *TimeoutError
+	return errors.As(er, &te)
+}
+
+func newExitResult(ps *os.ProcessState, started time.Time, reason stopReason) *ExitResult {
+	r := &ExitResult{
+		ExitCode:  -1,
+		TimedOut:  reason == stoppedByTimeout,
+		Stopped:   reason == stoppedByStop,
+		Unhealthy: reason == stoppedByProbe,
+		Restarted: reason == stoppedByRestart,
+		Duration:  time.Since(started),
+	}
+	if ps == nil {
+		return r
+	}
+
+	r.Pid = ps.Pid()
+	r.UserTime = ps.UserTime()
+	r.SystemTime = ps.SystemTime()
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok {
+		r.ExitCode = ws.ExitStatus()
+		if ws.Signaled() {
+			r.Signal = ws.Signal()
+		}
+	}
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		// Linux reports ru_maxrss in kilobytes.
+		r.MaxRSS = int64(ru.Maxrss) * 1024
+	}
+	return r
+}
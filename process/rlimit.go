@@ -0,0 +1,40 @@
+package process
+
+import "golang.org/x/sys/unix"
+
+// Rlimit is a resource limit applied to a process when it starts.
+// Resource is one of the unix.RLIMIT_* constants.
+type Rlimit struct {
+	Resource int
+	Cur, Max uint64
+}
+
+// SetRlimit limits resource for the process. Limits are set in the child
+// before it execs the command, by a copy of the calling binary that is
+// started in its place, so main must call ChildInit first.
+func (p *Process) SetRlimit(resource int, cur, max uint64) *Process {
+	for i := range p.rlimits {
+		if p.rlimits[i].Resource == resource {
+			p.rlimits[i].Cur, p.rlimits[i].Max = cur, max
+			return p
+		}
+	}
+	p.rlimits = append(p.rlimits, Rlimit{Resource: resource, Cur: cur, Max: max})
+	return p
+}
+
+func (p *Process) SetMaxOpenFiles(n uint64) *Process {
+	return p.SetRlimit(unix.RLIMIT_NOFILE, n, n)
+}
+
+func (p *Process) SetMaxCoreSize(bytes uint64) *Process {
+	return p.SetRlimit(unix.RLIMIT_CORE, bytes, bytes)
+}
+
+func (p *Process) SetMaxAddressSpace(bytes uint64) *Process {
+	return p.SetRlimit(unix.RLIMIT_AS, bytes, bytes)
+}
+
+func (p *Process) SetMaxProcs(n uint64) *Process {
+	return p.SetRlimit(unix.RLIMIT_NPROC, n, n)
+}
@@ -0,0 +1,117 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// A copy of this binary started by wrapChild is told apart by childArg0
+// in place of its argv[0], and finds its childSpec in childEnv.
+const (
+	childArg0 = "gearbox-child"
+	childEnv  = "_GEARBOX_CHILD"
+)
+
+// childSpec is what a child must apply between fork and exec that
+// SysProcAttr cannot express.
+type childSpec struct {
+	Path    string
+	Arg0    string
+	Rlimits []Rlimit
+	Cred    *syscall.Credential
+}
+
+var childInit bool
+
+var errNoChildInit = errors.New("rlimits need process.ChildInit to be called at the start of main")
+
+// ChildInit must be called at the start of main by programs that use
+// SetRlimit. Rlimits are set in a copy of the program, started in place
+// of the command, which calls ChildInit to apply them and exec the
+// command; ChildInit does not return there. Anywhere else it returns at
+// once. Package init functions run in the copy too, before main, so they
+// must not have side effects that matter there.
+func ChildInit() {
+	childInit = true
+	if len(os.Args) < 1 || os.Args[0] != childArg0 {
+		return
+	}
+	spec := os.Getenv(childEnv)
+	if spec == "" {
+		return
+	}
+	os.Unsetenv(childEnv)
+
+	var c childSpec
+	er := json.Unmarshal([]byte(spec), &c)
+	if er == nil {
+		er = setRlimits(c.Rlimits)
+	}
+	if er == nil {
+		er = setCredential(c.Cred)
+	}
+	if er == nil {
+		er = syscall.Exec(c.Path, append([]string{c.Arg0}, os.Args[1:]...), os.Environ())
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v\n", c.Path, er)
+	os.Exit(127)
+}
+
+// wrapChild makes cmd start a copy of this binary that sets limits and
+// then execs the command, so that they are in place before it runs. The
+// credential moves to the copy too, so that hard limits can still be
+// raised before privileges are dropped.
+func wrapChild(cmd *exec.Cmd, limits []Rlimit) error {
+	if len(limits) < 1 {
+		return nil
+	}
+	if !childInit {
+		return errNoChildInit
+	}
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	path := cmd.Path
+	if !filepath.IsAbs(path) && cmd.Dir != "" {
+		path = filepath.Join(cmd.Dir, path)
+	}
+	if _, er := exec.LookPath(path); er != nil {
+		return er
+	}
+
+	spec, er := json.Marshal(childSpec{
+		Path:    cmd.Path,
+		Arg0:    cmd.Args[0],
+		Rlimits: limits,
+		Cred:    cmd.SysProcAttr.Credential,
+	})
+	if er != nil {
+		return er
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, childEnv+"="+string(spec))
+	cmd.SysProcAttr.Credential = nil
+	cmd.Path = filepath.Join(procRoot, "self", "exe")
+	cmd.Args = append([]string{childArg0}, cmd.Args[1:]...)
+	return nil
+}
+
+// setRlimits applies limits to the current process. syscall.Setrlimit is
+// used so that exec does not restore the runtime's original open file
+// limit.
+func setRlimits(limits []Rlimit) error {
+	for _, l := range limits {
+		if er := syscall.Setrlimit(l.Resource, &syscall.Rlimit{Cur: l.Cur, Max: l.Max}); er != nil {
+			return er
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRlimitsNeedChildInit(t *testing.T) {
+	is := assert.New(t)
+	childInit = false
+	defer func() { childInit = true }()
+
+	p, er := New("ulimit", "true")
+	is.NoError(er)
+	p.SetMaxOpenFiles(64)
+	is.Equal(errNoChildInit, p.Execute(context.Background()))
+}
+
+func TestChildInitIgnoresEnv(t *testing.T) {
+	is := assert.New(t)
+	// The spec alone, e.g. leaked into the environment, must not make
+	// ChildInit exec anything.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), childEnv+`={"Path":"/bin/echo","Arg0":"echo"}`)
+	out, er := cmd.CombinedOutput()
+	is.NoError(er)
+	is.Contains(string(out), "PASS")
+}
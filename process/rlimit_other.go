@@ -0,0 +1,28 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errRlimits = errors.New("rlimits are only supported on linux")
+
+// ChildInit does nothing where rlimits are not supported.
+func ChildInit() {}
+
+func wrapChild(cmd *exec.Cmd, limits []Rlimit) error {
+	if len(limits) > 0 {
+		return errRlimits
+	}
+	return nil
+}
+
+func setRlimits(limits []Rlimit) error {
+	if len(limits) > 0 {
+		return errRlimits
+	}
+	return nil
+}
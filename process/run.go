@@ -0,0 +1,62 @@
+package process
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Run executes the process and waits for it to exit. The process is
+// stopped when ctx is done; if that was because of its deadline the error
+// is a *TimeoutError.
+func (p *Process) Run(ctx context.Context) (*ExitResult, error) {
+	if er := p.Execute(ctx); er != nil {
+		return nil, er
+	}
+	<-p.Exited()
+
+	r := p.Result()
+	if r.TimedOut {
+		return r, &TimeoutError{Name: p.name, Duration: r.Duration, Err: p.Error()}
+	}
+	return r, p.Error()
+}
+
+// Output runs the process and returns its stdout exactly as written.
+// Added writers still see the output as usual. An interactive process has
+// its stdout and stderr merged on the pty, and returns both.
+func (p *Process) Output(ctx context.Context) ([]byte, *ExitResult, error) {
+	var b bytes.Buffer
+	p.capOut, p.capErr = &b, nil
+	defer func() { p.capOut, p.capErr = nil, nil }()
+
+	r, er := p.Run(ctx)
+	return b.Bytes(), r, er
+}
+
+// CombinedOutput runs the process and returns its stdout and stderr
+// interleaved in the order they were read.
+func (p *Process) CombinedOutput(ctx context.Context) ([]byte, *ExitResult, error) {
+	var (
+		b bytes.Buffer
+		w = &lockedWriter{w: &b}
+	)
+	p.capOut, p.capErr = w, w
+	defer func() { p.capOut, p.capErr = nil, nil }()
+
+	r, er := p.Run(ctx)
+	return b.Bytes(), r, er
+}
+
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.w.Write(b)
+}
@@ -0,0 +1,100 @@
+package process
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRun(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run      int
+		cmd      string
+		stdin    string
+		timeout  time.Duration
+		output   string
+		combined string
+		code     int
+		timedOut bool
+	}{
+		{1, "sh -c 'echo out; echo err >&2'", "", time.Second, "out\n", "err\nout\n", 0, false},
+		{2, "sort", "b\na\n", time.Second, "a\nb\n", "a\nb\n", 0, false},
+		{3, "sh -c 'echo x; exit 2'", "", time.Second, "x\n", "x\n", 2, false},
+		{4, "sleep 10", "", 20 * time.Millisecond, "", "", -1, true},
+	}
+
+	for _, test := range tests {
+		for i, combined := range []bool{false, true} {
+			p, er := New("run", test.cmd)
+			is.NoError(er, "test %d", test.run)
+			if test.stdin != "" {
+				p.SetStdin(strings.NewReader(test.stdin))
+			}
+
+			c, q := context.WithTimeout(context.Background(), test.timeout)
+			var (
+				out      []byte
+				r        *ExitResult
+				expected = test.output
+			)
+			if combined {
+				out, r, er = p.CombinedOutput(c)
+				expected = test.combined
+			} else {
+				out, r, er = p.Output(c)
+			}
+			q()
+
+			is.Equal(test.code != 0, er != nil, "test %d.%d", test.run, i)
+			is.Equal(test.timedOut, IsTimeout(er), "test %d.%d", test.run, i)
+			is.Equal(test.code, r.ExitCode, "test %d.%d", test.run, i)
+			if combined {
+				lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+				is.ElementsMatch(strings.Split(strings.TrimSpace(expected), "\n"), lines, "test %d.%d", test.run, i)
+			} else {
+				is.Equal(expected, string(out), "test %d.%d", test.run, i)
+			}
+		}
+	}
+}
+
+func TestExitedBeforeExecute(t *testing.T) {
+	p, er := New("never", "true")
+	assert.NoError(t, er)
+	select {
+	case <-p.Exited():
+	default:
+		t.Fatal("Exited should be closed for a process that never started")
+	}
+}
+
+func TestOutputRaw(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run      int
+		cmd      string
+		expected string
+		lines    int
+	}{
+		{1, `printf 'a\r\nb'`, "a\r\nb", 2},
+		{2, `sh -c "head -c 100000 /dev/zero | tr '\\0' a"`, strings.Repeat("a", 100000), 2},
+		{3, `sh -c "head -c 100000 /dev/zero | tr '\\0' a; echo; echo b"`, strings.Repeat("a", 100000) + "\nb\n", 3},
+	}
+
+	for _, test := range tests {
+		p, er := New("raw", test.cmd)
+		is.NoError(er, "test %d", test.run)
+		p.KeepTail(10, 0)
+
+		out, _, er := p.Output(context.Background())
+		is.NoError(er, "test %d", test.run)
+		is.Equal(test.expected, string(out), "test %d", test.run)
+		// Lines longer than maxLine reach writers and the tail in pieces.
+		stdout, _ := p.Tail()
+		is.Len(stdout, test.lines, "test %d", test.run)
+	}
+}
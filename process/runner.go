@@ -0,0 +1,66 @@
+package process
+
+import (
+	"io"
+
+	"golang.org/x/net/context"
+)
+
+// Handle is a command started by a Runner. *Process is a Handle.
+type Handle interface {
+	Pid() int
+	Exited() <-chan struct{}
+	Result() *ExitResult
+	Error() error
+	Stop()
+	Kill() error
+}
+
+// Runner starts commands given as an argv. Run blocks until the command
+// exits and returns its result, with a *TimeoutError if ctx's deadline
+// stopped it; Start returns as soon as it is running. Both stop the command
+// when ctx is done.
+type Runner interface {
+	Run(ctx context.Context, name string, argv []string, out ...io.Writer) (*ExitResult, error)
+	Start(ctx context.Context, name string, argv []string, out ...io.Writer) (Handle, error)
+}
+
+type processRunner struct {
+	setup []func(*Process)
+}
+
+// NewRunner returns a Runner that runs each command as a Process. The setup
+// functions are applied to every Process before it is started.
+func NewRunner(setup ...func(*Process)) Runner {
+	return &processRunner{setup: setup}
+}
+
+func (r *processRunner) Start(ctx context.Context, name string, argv []string, out ...io.Writer) (Handle, error) {
+	p, er := r.process(name, argv, out...)
+	if er != nil {
+		return nil, er
+	}
+	if er := p.Execute(ctx); er != nil {
+		return nil, er
+	}
+	return p, nil
+}
+
+func (r *processRunner) Run(ctx context.Context, name string, argv []string, out ...io.Writer) (*ExitResult, error) {
+	p, er := r.process(name, argv, out...)
+	if er != nil {
+		return nil, er
+	}
+	return p.Run(ctx)
+}
+
+func (r *processRunner) process(name string, argv []string, out ...io.Writer) (*Process, error) {
+	p, er := NewArgv(name, argv, out...)
+	if er != nil {
+		return nil, er
+	}
+	for _, fn := range r.setup {
+		fn(p)
+	}
+	return p, nil
+}
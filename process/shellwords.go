@@ -0,0 +1,159 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Split breaks cmd into an argv following POSIX shell quoting rules: single
+// quotes preserve everything literally, double quotes allow backslash
+// escapes of $ ` " \ and newline, and an unquoted backslash escapes the next
+// character. No expansion of any kind is performed.
+func Split(cmd string) ([]string, error) {
+	return split(cmd, nil)
+}
+
+// SplitExpand is like Split but also expands $VAR and ${VAR} outside of
+// single quotes using mapping, e.g. os.Getenv. Expanded values are not
+// split into further words.
+func SplitExpand(cmd string, mapping func(string) string) ([]string, error) {
+	return split(cmd, mapping)
+}
+
+func split(s string, mapping func(string) string) ([]string, error) {
+	var (
+		args   = make([]string, 0, 4)
+		buf    bytes.Buffer
+		inWord bool
+		i      int
+	)
+
+	for i < len(s) {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n':
+			if inWord {
+				args = append(args, buf.String())
+				buf.Reset()
+				inWord = false
+			}
+			i++
+		case '\\':
+			if i+1 >= len(s) {
+				return nil, fmt.Errorf("trailing backslash in %q", s)
+			}
+			if s[i+1] != '\n' {
+				buf.WriteByte(s[i+1])
+				inWord = true
+			}
+			i += 2
+		case '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated single quote in %q", s)
+			}
+			buf.WriteString(s[i+1 : i+1+j])
+			inWord = true
+			i += j + 2
+		case '"':
+			n, er := splitDouble(s[i:], mapping, &buf)
+			if er != nil {
+				return nil, fmt.Errorf("%v in %q", er, s)
+			}
+			inWord = true
+			i += n
+		case '$':
+			if mapping == nil {
+				buf.WriteByte(c)
+				inWord = true
+				i++
+				continue
+			}
+			n, er := expandVar(s[i:], mapping, &buf)
+			if er != nil {
+				return nil, fmt.Errorf("%v in %q", er, s)
+			}
+			inWord = inWord || buf.Len() > 0
+			i += n
+		default:
+			buf.WriteByte(c)
+			inWord = true
+			i++
+		}
+	}
+	if inWord {
+		args = append(args, buf.String())
+	}
+	return args, nil
+}
+
+// splitDouble consumes the double quoted string at the start of s and
+// returns the number of bytes read.
+func splitDouble(s string, mapping func(string) string, buf *bytes.Buffer) (int, error) {
+	i := 1
+	for i < len(s) {
+		switch c := s[i]; c {
+		case '"':
+			return i + 1, nil
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+				if s[i+1] != '\n' {
+					buf.WriteByte(s[i+1])
+				}
+				i += 2
+				continue
+			}
+			buf.WriteByte(c)
+			i++
+		case '$':
+			if mapping == nil {
+				buf.WriteByte(c)
+				i++
+				continue
+			}
+			n, er := expandVar(s[i:], mapping, buf)
+			if er != nil {
+				return 0, er
+			}
+			i += n
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return 0, fmt.Errorf("unterminated double quote")
+}
+
+// expandVar expands the $VAR or ${VAR} reference at the start of s and
+// returns the number of bytes read. A $ not followed by a name is literal.
+func expandVar(s string, mapping func(string) string, buf *bytes.Buffer) (int, error) {
+	if len(s) > 1 && s[1] == '{' {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return 0, fmt.Errorf("unterminated ${")
+		}
+		buf.WriteString(mapping(s[2:end]))
+		return end + 1, nil
+	}
+
+	end := 1
+	for end < len(s) && isNameByte(s[end], end == 1) {
+		end++
+	}
+	if end == 1 {
+		buf.WriteByte('$')
+		return 1, nil
+	}
+	buf.WriteString(mapping(s[1:end]))
+	return end, nil
+}
+
+func isNameByte(c byte, first bool) bool {
+	switch {
+	case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		return true
+	case '0' <= c && c <= '9':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run   int
+		cmd   string
+		argv  []string
+		valid bool
+	}{
+		{1, "docker pull busybox", []string{"docker", "pull", "busybox"}, true},
+		{2, "  a \t b\n", []string{"a", "b"}, true},
+		{3, "chef-client --runlist='role[a], recipe[b]'", []string{"chef-client", "--runlist=role[a], recipe[b]"}, true},
+		{4, `echo "a \"b\" c" 'd\e'`, []string{"echo", `a "b" c`, `d\e`}, true},
+		{5, `echo a\ b \$HOME`, []string{"echo", "a b", "$HOME"}, true},
+		{6, `echo "" ''`, []string{"echo", "", ""}, true},
+		{7, "echo a\\\nb", []string{"echo", "ab"}, true},
+		{8, `echo "\n"`, []string{"echo", `\n`}, true},
+		{9, `echo $HOME`, []string{"echo", "$HOME"}, true},
+		{10, `echo 'unterminated`, nil, false},
+		{11, `echo "unterminated`, nil, false},
+		{12, `echo trailing\`, nil, false},
+		{13, "", []string{}, true},
+	}
+
+	for _, test := range tests {
+		argv, er := Split(test.cmd)
+		is.Equal(test.valid, er == nil, "test %d: %v", test.run, er)
+		is.Equal(test.argv, argv, "test %d", test.run)
+	}
+}
+
+func TestSplitExpand(t *testing.T) {
+	is := assert.New(t)
+	env := map[string]string{"HOME": "/root", "NAME": "a b"}
+	mapping := func(k string) string { return env[k] }
+
+	var tests = []struct {
+		run   int
+		cmd   string
+		argv  []string
+		valid bool
+	}{
+		{1, `ls $HOME`, []string{"ls", "/root"}, true},
+		{2, `ls ${HOME}/bin "$HOME"/x '$HOME'`, []string{"ls", "/root/bin", "/root/x", "$HOME"}, true},
+		{3, `echo $NAME`, []string{"echo", "a b"}, true},
+		{4, `echo $MISSING end`, []string{"echo", "end"}, true},
+		{5, `echo "$MISSING"`, []string{"echo", ""}, true},
+		{6, `echo $ \$HOME $1`, []string{"echo", "$", "$HOME", "$1"}, true},
+		{7, `echo ${HOME`, nil, false},
+	}
+
+	for _, test := range tests {
+		argv, er := SplitExpand(test.cmd, mapping)
+		is.Equal(test.valid, er == nil, "test %d: %v", test.run, er)
+		is.Equal(test.argv, argv, "test %d", test.run)
+	}
+}
@@ -0,0 +1,133 @@
+package process
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// forwarder relays signals received by this process to a child, optionally
+// translating them first (e.g. SIGHUP to SIGUSR1).
+type forwarder struct {
+	sigs []os.Signal
+	m    map[os.Signal]os.Signal
+
+	mu    sync.Mutex
+	ch    chan os.Signal
+	done  chan struct{}
+	relay func(os.Signal)
+	holds int
+}
+
+func (f *forwarder) add(sigs ...os.Signal) {
+	for _, sig := range sigs {
+		if !f.has(sig) {
+			f.sigs = append(f.sigs, sig)
+		}
+	}
+}
+
+func (f *forwarder) has(sig os.Signal) bool {
+	for _, s := range f.sigs {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *forwarder) mapSignal(from, to os.Signal) {
+	if f.m == nil {
+		f.m = make(map[os.Signal]os.Signal)
+	}
+	f.m[from] = to
+	f.add(from)
+}
+
+// start installs handlers for the forwarded signals, unless they are
+// installed already, and calls relay with each one received, translated,
+// until stop is called.
+func (f *forwarder) start(relay func(os.Signal)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.relay = relay
+	f.install()
+}
+
+// stop stops relaying signals. The handlers stay installed while the
+// forwarder is held, and signals received meanwhile are dropped, so that
+// they do not take their default action, e.g. killing this process,
+// between two runs of a child.
+func (f *forwarder) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.relay = nil
+	if f.holds < 1 {
+		f.uninstall()
+	}
+}
+
+// hold keeps the handlers installed, from now on, until release.
+func (f *forwarder) hold() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.holds++
+	f.install()
+}
+
+func (f *forwarder) release() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.holds--
+	if f.holds < 1 && f.relay == nil {
+		f.uninstall()
+	}
+}
+
+// install must be called with f.mu held.
+func (f *forwarder) install() {
+	if len(f.sigs) < 1 || f.ch != nil {
+		return
+	}
+	var (
+		ch   = make(chan os.Signal, len(f.sigs))
+		done = make(chan struct{})
+		m    = make(map[os.Signal]os.Signal, len(f.m))
+	)
+	for k, v := range f.m {
+		m[k] = v
+	}
+	f.ch, f.done = ch, done
+	signal.Notify(ch, f.sigs...)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				if to, ok := m[sig]; ok {
+					sig = to
+				}
+				f.mu.Lock()
+				relay := f.relay
+				f.mu.Unlock()
+				if relay == nil {
+					log.Printf("[info] nothing running to forward %v to, dropping it", sig)
+					continue
+				}
+				relay(sig)
+			}
+		}
+	}()
+}
+
+// uninstall must be called with f.mu held.
+func (f *forwarder) uninstall() {
+	if f.ch == nil {
+		return
+	}
+	signal.Stop(f.ch)
+	close(f.done)
+	f.ch, f.done = nil, nil
+}
@@ -0,0 +1,143 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is a stage in the lifecycle of a Process.
+type State int
+
+const (
+	Created State = iota
+	Starting
+	Running
+	Stopping
+	Exited
+	Restarting
+	Failed
+)
+
+var ErrRunning = errors.New("process is already running")
+
+func (s State) String() string {
+	switch s {
+	case Created:
+		return "created"
+	case Starting:
+		return "starting"
+	case Running:
+		return "running"
+	case Stopping:
+		return "stopping"
+	case Exited:
+		return "exited"
+	case Restarting:
+		return "restarting"
+	case Failed:
+		return "failed"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Transition is a change in the State of a Process.
+type Transition struct {
+	From, To State
+	Time     time.Time
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%v -> %v", t.From, t.To)
+}
+
+func (p *Process) State() State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// OnTransition calls fn with every later change of state. Calls are made
+// in order from a separate goroutine, so fn may use the Process freely.
+func (p *Process) OnTransition(fn func(Transition)) *Process {
+	p.states.Lock()
+	defer p.states.Unlock()
+	p.states.fns = append(p.states.fns, fn)
+	return p
+}
+
+// Transitions returns a channel that receives every later change of state.
+// Transitions are dropped while the channel is full.
+func (p *Process) Transitions(buffer int) <-chan Transition {
+	c := make(chan Transition, buffer)
+	p.states.Lock()
+	defer p.states.Unlock()
+	p.states.chans = append(p.states.chans, c)
+	return c
+}
+
+// setState moves the process to s. p.mu must be held, which keeps the
+// transitions in order.
+func (p *Process) setState(s State) {
+	if p.state == s {
+		return
+	}
+	p.states.publish(Transition{From: p.state, To: s, Time: time.Now()})
+	p.state = s
+}
+
+func (p *Process) transition(s State) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setState(s)
+}
+
+// stateHub delivers transitions to subscribers from a goroutine of its
+// own, started whenever there are transitions queued.
+type stateHub struct {
+	sync.Mutex
+	fns        []func(Transition)
+	chans      []chan Transition
+	queue      []Transition
+	delivering bool
+}
+
+func (h *stateHub) publish(t Transition) {
+	h.Lock()
+	defer h.Unlock()
+	if len(h.fns) < 1 && len(h.chans) < 1 {
+		return
+	}
+	h.queue = append(h.queue, t)
+	if !h.delivering {
+		h.delivering = true
+		go h.deliver()
+	}
+}
+
+func (h *stateHub) deliver() {
+	for {
+		h.Lock()
+		if len(h.queue) < 1 {
+			h.delivering = false
+			h.Unlock()
+			return
+		}
+		t := h.queue[0]
+		h.queue = h.queue[1:]
+		fns := append([]func(Transition){}, h.fns...)
+		chans := append([]chan Transition{}, h.chans...)
+		h.Unlock()
+
+		for _, fn := range fns {
+			fn(t)
+		}
+		for _, c := range chans {
+			select {
+			case c <- t:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package process
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestStateTransitions(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run      int
+		cmd      string
+		stop     bool
+		expected []State
+	}{
+		{1, "true", false, []State{Starting, Running, Exited}},
+		{2, "sleep 10", true, []State{Starting, Running, Stopping, Exited}},
+	}
+
+	for _, test := range tests {
+		p, er := New("state", test.cmd)
+		is.NoError(er, "test %d", test.run)
+		is.Equal(Created, p.State(), "test %d", test.run)
+
+		var (
+			seen  []State
+			calls = make(chan Transition, 10)
+			c     = p.Transitions(10)
+		)
+		p.OnTransition(func(tr Transition) { calls <- tr })
+
+		is.NoError(p.Execute(context.Background()), "test %d", test.run)
+		if test.stop {
+			is.Equal(ErrRunning, p.Execute(context.Background()), "test %d", test.run)
+			p.Stop()
+			p.Stop()
+		}
+		<-p.Exited()
+		is.True(p.Dead(), "test %d", test.run)
+
+		for range test.expected {
+			select {
+			case tr := <-c:
+				seen = append(seen, tr.To)
+				is.Equal(tr, <-calls, "test %d", test.run)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("test %d: missing transitions after %v", test.run, seen)
+			}
+		}
+		is.Equal(test.expected, seen, "test %d", test.run)
+	}
+}
+
+func TestStateFailed(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("failed", "true")
+	is.NoError(er)
+	p.Stop()
+
+	p.SetDir(os.DevNull)
+	is.Error(p.Execute(context.Background()))
+	is.Equal(Failed, p.State())
+	is.Error(p.Error())
+	<-p.Exited()
+}
+
+func TestExecuteAndRestartStop(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("loop", "sleep 0.01")
+	is.NoError(er)
+	restarted := make(chan struct{}, 1)
+	p.OnTransition(func(tr Transition) {
+		if tr.To == Restarting {
+			select {
+			case restarted <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.ExecuteAndRestart(context.Background())
+		close(done)
+	}()
+	select {
+	case <-restarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("process was not restarted")
+	}
+	p.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ExecuteAndRestart did not return after Stop")
+	}
+}
@@ -0,0 +1,335 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"golang.org/x/net/context"
+)
+
+type RestartPolicy int
+
+const (
+	RestartAlways RestartPolicy = iota
+	RestartOnFailure
+	RestartNever
+)
+
+func (r RestartPolicy) String() string {
+	switch r {
+	case RestartAlways:
+		return "always"
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartNever:
+		return "never"
+	}
+	return fmt.Sprintf("RestartPolicy(%d)", int(r))
+}
+
+// Policy controls how a Supervisor restarts a process. Restarts are delayed
+// by an exponential backoff between MinBackoff and MaxBackoff, and the
+// process is given up on if it restarts more than MaxRestarts times within
+// Window. A zero MaxRestarts disables the limit.
+type Policy struct {
+	Restart     RestartPolicy
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxRestarts int
+	Window      time.Duration
+}
+
+var DefaultPolicy = Policy{
+	Restart:     RestartOnFailure,
+	MinBackoff:  500 * time.Millisecond,
+	MaxBackoff:  30 * time.Second,
+	MaxRestarts: 5,
+	Window:      time.Minute,
+}
+
+var (
+	ErrSupervisorStarted = errors.New("supervisor already started")
+	ErrSupervisorStopped = errors.New("supervisor stopped")
+)
+
+func (pol Policy) shouldRestart(failed bool) bool {
+	switch pol.Restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return failed
+	}
+	return false
+}
+
+func (pol Policy) backOff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	if pol.MinBackoff > 0 {
+		b.InitialInterval = pol.MinBackoff
+	}
+	if pol.MaxBackoff > 0 {
+		b.MaxInterval = pol.MaxBackoff
+	}
+	b.MaxElapsedTime = 0
+	b.Reset()
+	return b
+}
+
+type supervised struct {
+	p        *Process
+	policy   Policy
+	restarts []time.Time
+	er       error
+}
+
+// allow records a restart at t and reports whether it stays within the
+// policy's restart limit.
+func (s *supervised) allow(t time.Time) bool {
+	if s.policy.MaxRestarts < 1 {
+		return true
+	}
+	cutoff := t.Add(-s.policy.Window)
+	kept := s.restarts[:0]
+	for _, r := range s.restarts {
+		if r.After(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	s.restarts = append(kept, t)
+	return len(s.restarts) <= s.policy.MaxRestarts
+}
+
+// Supervisor runs a named set of processes and restarts them according to
+// their Policy until Stop is called. A process stopped with its own Stop is
+// not restarted.
+type Supervisor struct {
+	mu      sync.Mutex
+	stopped bool
+	procs   map[string]*supervised
+	order   []string
+	c       context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	fwd     forwarder
+	metrics *Metrics
+}
+
+func NewSupervisor() *Supervisor {
+	return &Supervisor{procs: make(map[string]*supervised)}
+}
+
+// Add registers p under its name. Processes added after Start are started
+// immediately.
+func (s *Supervisor) Add(p *Process, pol Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.procs[p.name]; ok {
+		return fmt.Errorf("supervisor: process %q already added", p.name)
+	}
+	if s.metrics != nil {
+		p.SetMetrics(s.metrics)
+	}
+	sp := &supervised{p: p, policy: pol}
+	s.procs[p.name] = sp
+	s.order = append(s.order, p.name)
+	if s.c != nil && !s.stopped {
+		s.wg.Add(1)
+		go s.supervise(sp)
+	}
+	return nil
+}
+
+func (s *Supervisor) Get(name string) (*Process, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sp, ok := s.procs[name]
+	if !ok {
+		return nil, false
+	}
+	return sp.p, true
+}
+
+func (s *Supervisor) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.order...)
+}
+
+// ForwardSignals relays sigs received by this process to every supervised
+// process once the supervisor is started.
+func (s *Supervisor) ForwardSignals(sigs ...os.Signal) *Supervisor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fwd.add(sigs...)
+	return s
+}
+
+// MapSignal forwards from to the supervised processes as to.
+func (s *Supervisor) MapSignal(from, to os.Signal) *Supervisor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fwd.mapSignal(from, to)
+	return s
+}
+
+// SetMetrics records the runs of every supervised process in m.
+func (s *Supervisor) SetMetrics(m *Metrics) *Supervisor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = m
+	for _, sp := range s.procs {
+		sp.p.SetMetrics(m)
+	}
+	return s
+}
+
+func (s *Supervisor) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return ErrSupervisorStopped
+	}
+	if s.c != nil {
+		return ErrSupervisorStarted
+	}
+	s.c, s.cancel = context.WithCancel(ctx)
+	s.fwd.start(s.signal)
+	for _, name := range s.order {
+		s.wg.Add(1)
+		go s.supervise(s.procs[name])
+	}
+	return nil
+}
+
+// Stop terminates every supervised process and waits for them to exit. No
+// process is started once Stop has been called.
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+	s.fwd.stop()
+}
+
+func (s *Supervisor) signal(sig os.Signal) {
+	s.mu.Lock()
+	procs := make([]*Process, 0, len(s.procs))
+	for _, sp := range s.procs {
+		procs = append(procs, sp.p)
+	}
+	s.mu.Unlock()
+
+	for _, p := range procs {
+		// A process between runs has no child to signal.
+		if st := p.State(); st != Running && st != Stopping {
+			log.Printf("[info] %v is not running, not forwarding %v", p, sig)
+			continue
+		}
+		log.Printf("[info] forwarding %v to %v", sig, p)
+		p.Signal(sig)
+	}
+}
+
+// Wait blocks until every supervised process has exited and will not be
+// restarted.
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+// Errors returns the reason each process that gave up stopped being
+// supervised, keyed by name.
+func (s *Supervisor) Errors() map[string]error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := make(map[string]error)
+	for name, sp := range s.procs {
+		if sp.er != nil {
+			errs[name] = sp.er
+		}
+	}
+	return errs
+}
+
+func (s *Supervisor) supervise(sp *supervised) {
+	defer s.wg.Done()
+	sp.p.fwd.hold()
+	defer sp.p.fwd.release()
+
+	var (
+		p = sp.p
+		b = sp.policy.backOff()
+	)
+	for {
+		start := time.Now()
+		if er := p.Execute(s.c); er != nil {
+			s.fail(sp, er)
+			return
+		}
+
+		select {
+		case <-s.c.Done():
+			<-p.Exited()
+			return
+		case <-p.Exited():
+		}
+
+		select {
+		case <-p.stopChan():
+			return
+		default:
+		}
+		r := p.Result()
+		if r != nil && r.Restarted {
+			log.Printf("[info] %v restarting on request", p)
+			p.transition(Restarting)
+			continue
+		}
+		// A process stopped by its liveness probe is restarted whatever the
+		// policy, but still counts against the restart limit.
+		sick := r != nil && r.Unhealthy
+		failed := p.Error() != nil
+		if !sick && !sp.policy.shouldRestart(failed) {
+			if failed {
+				s.fail(sp, p.Error())
+			}
+			return
+		}
+		if time.Since(start) > b.MaxInterval {
+			b.Reset()
+		}
+		if !sp.allow(time.Now()) {
+			s.fail(sp, fmt.Errorf("%s restarted more than %d times in %v", p.name, sp.policy.MaxRestarts, sp.policy.Window))
+			return
+		}
+
+		p.transition(Restarting)
+		wait := b.NextBackOff()
+		log.Printf("[info] %v exited (error=%v), restarting in %v", p, p.Error(), wait)
+		select {
+		case <-s.c.Done():
+			p.transition(Exited)
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (s *Supervisor) fail(sp *supervised, er error) {
+	log.Printf("[error] supervisor: %s: %v", sp.p.name, er)
+	sp.p.transition(Failed)
+	s.mu.Lock()
+	sp.er = er
+	s.mu.Unlock()
+}
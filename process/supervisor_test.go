@@ -0,0 +1,169 @@
+package process
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestShouldRestart(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run     int
+		policy  RestartPolicy
+		failed  bool
+		restart bool
+	}{
+		{1, RestartAlways, false, true},
+		{2, RestartAlways, true, true},
+		{3, RestartOnFailure, false, false},
+		{4, RestartOnFailure, true, true},
+		{5, RestartNever, false, false},
+		{6, RestartNever, true, false},
+	}
+
+	for _, test := range tests {
+		pol := Policy{Restart: test.policy}
+		is.Equal(test.restart, pol.shouldRestart(test.failed), "test %d", test.run)
+	}
+}
+
+func TestRestartLimit(t *testing.T) {
+	is := assert.New(t)
+	var (
+		now = time.Now()
+		sp  = &supervised{policy: Policy{MaxRestarts: 2, Window: time.Minute}}
+	)
+
+	is.True(sp.allow(now))
+	is.True(sp.allow(now.Add(time.Second)))
+	is.False(sp.allow(now.Add(2 * time.Second)))
+	is.True(sp.allow(now.Add(2 * time.Minute)))
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("false", "false")
+	is.NoError(er)
+
+	s := NewSupervisor()
+	is.NoError(s.Add(p, Policy{
+		Restart:     RestartOnFailure,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		MaxRestarts: 2,
+		Window:      time.Minute,
+	}))
+	is.Error(s.Add(p, DefaultPolicy))
+	is.NoError(s.Start(context.Background()))
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.Stop()
+		t.Fatal("supervisor did not give up")
+	}
+	is.Error(s.Errors()["false"])
+}
+
+func TestSupervisorStopped(t *testing.T) {
+	is := assert.New(t)
+	s := NewSupervisor()
+	is.NoError(s.Start(context.Background()))
+	s.Stop()
+
+	p, er := New("late", "true")
+	is.NoError(er)
+	is.NoError(s.Add(p, DefaultPolicy))
+	s.Wait()
+	is.Equal(Created, p.State())
+	is.Equal(ErrSupervisorStopped, s.Start(context.Background()))
+}
+
+func TestSupervisorStopDuringBackoff(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("false", "false")
+	is.NoError(er)
+	states := p.Transitions(8)
+
+	s := NewSupervisor()
+	is.NoError(s.Add(p, Policy{Restart: RestartOnFailure, MinBackoff: time.Minute}))
+	is.NoError(s.Start(context.Background()))
+	for tr := range states {
+		if tr.To == Restarting {
+			break
+		}
+	}
+	s.Stop()
+	s.Wait()
+	is.Equal(Exited, p.State())
+	is.True(p.Dead())
+}
+
+func TestForwardedSignalDuringBackoff(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("false", "false")
+	is.NoError(er)
+	p.ForwardSignals(syscall.SIGHUP)
+	states := p.Transitions(8)
+
+	s := NewSupervisor()
+	is.NoError(s.Add(p, Policy{Restart: RestartOnFailure, MinBackoff: time.Minute}))
+	is.NoError(s.Start(context.Background()))
+	defer s.Stop()
+	for tr := range states {
+		if tr.To == Restarting {
+			break
+		}
+	}
+	// Without a handler installed this would kill the test binary.
+	is.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+	time.Sleep(50 * time.Millisecond)
+	is.Equal(Restarting, p.State())
+}
+
+func TestSupervisorRestartsUnhealthy(t *testing.T) {
+	is := assert.New(t)
+	// The process exits cleanly when stopped, so only the probe can
+	// cause a restart under RestartNever.
+	p, er := New("sick", `sh -c 'trap "exit 0" TERM; while :; do sleep 0.01; done'`)
+	is.NoError(er)
+	p.SetLivenessProbe(ProbeConfig{
+		Probe:            ExecProbe("false"),
+		Interval:         10 * time.Millisecond,
+		FailureThreshold: 2,
+	}, true)
+
+	s := NewSupervisor()
+	is.NoError(s.Add(p, Policy{
+		Restart:     RestartNever,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		MaxRestarts: 1,
+		Window:      time.Minute,
+	}))
+	is.NoError(s.Start(context.Background()))
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.Stop()
+		t.Fatal("unhealthy process was not restarted")
+	}
+	if is.Error(s.Errors()["sick"]) {
+		is.Contains(s.Errors()["sick"].Error(), "restarted more than 1 times")
+	}
+}
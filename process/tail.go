@@ -0,0 +1,82 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// TailError is returned by Error when a process with KeepTail enabled
+// fails. It carries the last captured lines of each stream.
+type TailError struct {
+	Err    error
+	Stdout []string
+	Stderr []string
+}
+
+func (e *TailError) Error() string {
+	lines := e.Stderr
+	if len(lines) < 1 {
+		lines = e.Stdout
+	}
+	if len(lines) < 1 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Err, strings.Join(lines, "\n"))
+}
+
+// ringBuffer keeps the most recent lines written to it, bounded by a line
+// count and a total size in bytes. A zero bound is unlimited.
+type ringBuffer struct {
+	sync.Mutex
+	lines              []string
+	size               int
+	maxLines, maxBytes int
+}
+
+func newRingBuffer(lines, bytes int) *ringBuffer {
+	return &ringBuffer{maxLines: lines, maxBytes: bytes}
+}
+
+func (r *ringBuffer) add(line string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.maxBytes > 0 && len(line) > r.maxBytes {
+		line = line[len(line)-r.maxBytes:]
+	}
+	r.lines = append(r.lines, line)
+	r.size += len(line)
+	for len(r.lines) > 0 && r.full() {
+		r.size -= len(r.lines[0])
+		r.lines = r.lines[1:]
+	}
+}
+
+func (r *ringBuffer) full() bool {
+	return (r.maxLines > 0 && len(r.lines) > r.maxLines) ||
+		(r.maxBytes > 0 && r.size > r.maxBytes)
+}
+
+func (r *ringBuffer) snapshot() []string {
+	if r == nil {
+		return nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	return append([]string{}, r.lines...)
+}
+
+func (r *ringBuffer) reset() {
+	r.Lock()
+	defer r.Unlock()
+	r.lines = nil
+	r.size = 0
+}
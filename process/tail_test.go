@@ -0,0 +1,85 @@
+package process
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRingBuffer(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run      int
+		lines    int
+		bytes    int
+		input    []string
+		expected []string
+	}{
+		{1, 2, 0, []string{"a", "b", "c"}, []string{"b", "c"}},
+		{2, 0, 4, []string{"aa", "bb", "cc"}, []string{"bb", "cc"}},
+		{3, 5, 3, []string{"abcdef"}, []string{"def"}},
+		{4, 3, 0, []string{"a"}, []string{"a"}},
+		{5, 0, 0, []string{"a", "b"}, []string{"a", "b"}},
+	}
+
+	for _, test := range tests {
+		r := newRingBuffer(test.lines, test.bytes)
+		for _, line := range test.input {
+			r.add(line)
+		}
+		is.Equal(test.expected, r.snapshot(), "test %d", test.run)
+	}
+}
+
+func TestTailAttachedToError(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("fail", "sh -c 'echo out; echo one >&2; echo two >&2; exit 1'")
+	is.NoError(er)
+	p.KeepTail(1, 0)
+
+	is.NoError(p.Execute(context.Background()))
+	<-p.Exited()
+
+	stdout, stderr := p.Tail()
+	is.Equal([]string{"out"}, stdout)
+	is.Equal([]string{"two"}, stderr)
+	if te, ok := p.Error().(*TailError); is.True(ok) {
+		is.Equal([]string{"two"}, te.Stderr)
+		is.Contains(te.Error(), "two")
+	}
+}
+
+func TestTailAttachedToTimeout(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("slow", "sh -c 'echo waiting >&2; sleep 10'")
+	is.NoError(er)
+	p.KeepTail(1, 0)
+
+	c, q := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer q()
+	_, er = p.Run(c)
+	is.True(IsTimeout(er))
+	is.Contains(er.Error(), "waiting")
+	var te *TailError
+	if is.True(errors.As(er, &te)) {
+		is.Equal([]string{"waiting"}, te.Stderr)
+	}
+}
+
+func TestExitedWithOrphanHoldingOutput(t *testing.T) {
+	is := assert.New(t)
+	p, er := New("orphan", "sh -c 'sleep 3 & echo done'")
+	is.NoError(er)
+	p.KeepTail(1, 0)
+
+	start := time.Now()
+	is.NoError(p.Execute(context.Background()))
+	<-p.Exited()
+	is.True(time.Since(start) < time.Second, "exited after %v", time.Since(start))
+
+	stdout, _ := p.Tail()
+	is.Equal([]string{"done"}, stdout)
+}
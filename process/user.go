@@ -0,0 +1,106 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SetUserName runs the process as the named user, with the uid, primary
+// gid and supplementary groups looked up from the passwd and group
+// databases when the process is executed. If loginEnv is set, HOME, USER
+// and LOGNAME are set for the user in the child's environment.
+func (p *Process) SetUserName(name string, loginEnv bool) *Process {
+	p.user = name
+	p.loginEnv = loginEnv
+	p.cred = nil
+	return p
+}
+
+// credentials returns the credential and environment the process runs
+// with, looking up the user set by SetUserName if there is one.
+func (p *Process) credentials() (*syscall.Credential, []string, error) {
+	if p.user == "" {
+		return p.cred, p.env, nil
+	}
+	cred, env, er := p.lookupUser()
+	if er != nil {
+		return nil, nil, fmt.Errorf("could not run %s as %s: %v", p.name, p.user, er)
+	}
+	return cred, env, nil
+}
+
+// lookupUser resolves the user set by SetUserName into the credential and
+// environment the process runs with.
+func (p *Process) lookupUser() (*syscall.Credential, []string, error) {
+	u, er := user.Lookup(p.user)
+	if er != nil {
+		return nil, nil, er
+	}
+	uid, er := strconv.ParseUint(u.Uid, 10, 32)
+	if er != nil {
+		return nil, nil, er
+	}
+	gid, er := strconv.ParseUint(u.Gid, 10, 32)
+	if er != nil {
+		return nil, nil, er
+	}
+	gids, er := u.GroupIds()
+	if er != nil {
+		return nil, nil, er
+	}
+
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	for _, g := range gids {
+		id, er := strconv.ParseUint(g, 10, 32)
+		if er != nil {
+			return nil, nil, er
+		}
+		cred.Groups = append(cred.Groups, uint32(id))
+	}
+
+	env := p.env
+	if p.loginEnv {
+		if env == nil {
+			env = os.Environ()
+		}
+		env = setEnv(env, "HOME", u.HomeDir)
+		env = setEnv(env, "USER", u.Username)
+		env = setEnv(env, "LOGNAME", u.Username)
+	}
+	return cred, env, nil
+}
+
+// setEnv returns env with key set to value, replacing any existing value.
+func setEnv(env []string, key, value string) []string {
+	out := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, key+"=") {
+			out = append(out, kv)
+		}
+	}
+	return append(out, key+"="+value)
+}
+
+// setCredential switches the current process to cred, if it is set.
+func setCredential(cred *syscall.Credential) error {
+	if cred == nil {
+		return nil
+	}
+	if !cred.NoSetGroups {
+		groups := make([]int, len(cred.Groups))
+		for i, g := range cred.Groups {
+			groups[i] = int(g)
+		}
+		if er := syscall.Setgroups(groups); er != nil {
+			return er
+		}
+	}
+	if er := syscall.Setgid(int(cred.Gid)); er != nil {
+		return er
+	}
+	return syscall.Setuid(int(cred.Uid))
+}
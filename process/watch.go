@@ -0,0 +1,148 @@
+package process
+
+import (
+	"crypto/sha1"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/albertrdixon/gearbox/util"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/context"
+)
+
+// DefaultDebounce is used when a WatchConfig has no Debounce.
+const DefaultDebounce = 500 * time.Millisecond
+
+// WatchConfig describes files or directories whose changes should reach a
+// running process. Events are collected until none arrive for Debounce,
+// and nothing happens unless the watched contents actually changed. The
+// process is sent Signal, or restarted if Signal is nil.
+type WatchConfig struct {
+	Paths    []string
+	Debounce time.Duration
+	Signal   os.Signal
+}
+
+// SetWatch watches the paths in wc while the process runs.
+func (p *Process) SetWatch(wc WatchConfig) *Process {
+	p.watch = &wc
+	return p
+}
+
+// Restart terminates the current run so that ExecuteAndRestart or a
+// Supervisor starts the process again. The ExitResult of the run has
+// Restarted set.
+func (p *Process) Restart() error {
+	p.stopping(stoppedByRestart)
+	return p.Term()
+}
+
+func runWatch(p *Process, c context.Context, wc *WatchConfig) {
+	w, er := fsnotify.NewWatcher()
+	if er != nil {
+		log.Printf("[warn] %v cannot watch files: %v", p, er)
+		return
+	}
+	defer w.Close()
+
+	// Files are watched through their directory so that editors which
+	// replace a file by renaming over it do not end the watch.
+	var (
+		files = make(map[string]bool)
+		dirs  = make(map[string]bool)
+	)
+	for _, path := range wc.Paths {
+		path = filepath.Clean(path)
+		dir := path
+		if fi, er := os.Stat(path); er == nil && fi.IsDir() {
+			dirs[path] = true
+		} else {
+			files[path] = true
+			dir = filepath.Dir(path)
+		}
+		if er := w.Add(dir); er != nil {
+			log.Printf("[warn] %v cannot watch %s: %v", p, path, er)
+		}
+	}
+
+	debounce := wc.Debounce
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+
+	var (
+		sum   = hashPaths(wc.Paths)
+		timer <-chan time.Time
+	)
+	for {
+		select {
+		case <-c.Done():
+			return
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if !files[ev.Name] && !dirs[filepath.Dir(ev.Name)] {
+				continue
+			}
+			timer = time.After(debounce)
+		case er, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[warn] %v watch error: %v", p, er)
+		case <-timer:
+			timer = nil
+			s := hashPaths(wc.Paths)
+			if s == sum {
+				continue
+			}
+			sum = s
+			if wc.Signal != nil {
+				log.Printf("[info] watched files changed, sending %v to %v", wc.Signal, p)
+				p.Signal(wc.Signal)
+				continue
+			}
+			log.Printf("[info] watched files changed, restarting %v", p)
+			p.Restart()
+			return
+		}
+	}
+}
+
+// hashPaths hashes the contents of paths, and of the regular files directly
+// inside any directories among them, so that changes to metadata alone go
+// unnoticed.
+func hashPaths(paths []string) string {
+	var parts []interface{}
+	for _, path := range paths {
+		fi, er := os.Stat(path)
+		if er != nil {
+			parts = append(parts, path, "<missing>")
+			continue
+		}
+		if !fi.IsDir() {
+			b, _ := ioutil.ReadFile(path)
+			parts = append(parts, path, string(b))
+			continue
+		}
+
+		infos, _ := ioutil.ReadDir(path)
+		names := make([]string, 0, len(infos))
+		for _, fi := range infos {
+			if fi.Mode().IsRegular() {
+				names = append(names, fi.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b, _ := ioutil.ReadFile(filepath.Join(path, name))
+			parts = append(parts, filepath.Join(path, name), string(b))
+		}
+	}
+	return util.Hashf(sha1.New(), parts...)
+}
@@ -0,0 +1,88 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestWatchSignal(t *testing.T) {
+	is := assert.New(t)
+	dir, er := ioutil.TempDir("", "watch")
+	is.NoError(er)
+	defer os.RemoveAll(dir)
+
+	conf := filepath.Join(dir, "app.conf")
+	is.NoError(ioutil.WriteFile(conf, []byte("a=1\n"), 0644))
+
+	p, er := NewArgv("reload", []string{"sh", "-c", "trap 'echo reloaded' HUP; echo started; while true; do sleep 0.01; done"})
+	is.NoError(er)
+	p.SetWatch(WatchConfig{Paths: []string{conf}, Debounce: 20 * time.Millisecond, Signal: syscall.SIGHUP})
+	sub := p.Subscribe(10)
+	defer sub.Close()
+
+	is.NoError(p.Execute(context.Background()))
+	defer p.Kill()
+	is.Equal("started", next(t, sub.C))
+
+	// Touching the file without changing it must not reload.
+	now := time.Now().Add(time.Minute)
+	is.NoError(os.Chtimes(conf, now, now))
+	select {
+	case l := <-sub.C:
+		t.Fatalf("unexpected line %q after mtime change", l.Text)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Replace the file by renaming over it, as editors do.
+	tmp := filepath.Join(dir, ".app.conf.tmp")
+	is.NoError(ioutil.WriteFile(tmp, []byte("a=2\n"), 0644))
+	is.NoError(os.Rename(tmp, conf))
+	is.Equal("reloaded", next(t, sub.C))
+}
+
+func TestWatchRestart(t *testing.T) {
+	is := assert.New(t)
+	dir, er := ioutil.TempDir("", "watch")
+	is.NoError(er)
+	defer os.RemoveAll(dir)
+
+	p, er := NewArgv("restart", []string{"sh", "-c", "echo started; sleep 10"})
+	is.NoError(er)
+	p.SetProcessGroup().SetWatch(WatchConfig{Paths: []string{dir}, Debounce: 20 * time.Millisecond})
+	sub := p.Subscribe(10)
+	defer sub.Close()
+
+	c, q := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.ExecuteAndRestart(c)
+		close(done)
+	}()
+	is.Equal("started", next(t, sub.C))
+
+	// Give the watcher time to start before changing anything.
+	time.Sleep(100 * time.Millisecond)
+	is.NoError(ioutil.WriteFile(filepath.Join(dir, "new.conf"), []byte("x"), 0644))
+	is.Equal("started", next(t, sub.C))
+
+	q()
+	<-done
+	<-p.Exited()
+}
+
+func next(t *testing.T, c <-chan Line) string {
+	select {
+	case l := <-c:
+		return l.Text
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for output")
+	}
+	return ""
+}
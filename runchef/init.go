@@ -1,36 +1,25 @@
 package main
 
 import (
-	"io/ioutil"
 	"os"
-	"os/exec"
-	"strings"
 
 	"github.com/albertrdixon/gearbox/logger"
+	"github.com/albertrdixon/gearbox/process"
 )
 
 func parseEnvFile(file string) error {
-	b, er := ioutil.ReadFile(file)
+	vars, er := process.ReadEnvFile(file, false)
 	if er != nil {
 		return er
 	}
-	for _, line := range strings.Split(string(b), "\n") {
-		bits := strings.Split(line, "=")
-		if len(bits) == 2 {
-			logger.Debugf("Setting %s to %s", bits[0], bits[1])
-			os.Setenv(bits[0], bits[1])
-		}
+	for k, v := range vars {
+		logger.Debugf("Setting %s to %s", k, v)
+		os.Setenv(k, v)
 	}
 	return nil
 }
 
 func init() {
-	d, er := exec.LookPath("docker")
-	if er != nil {
-		panic(er)
-	}
-	docker = d
-
 	if _, er := os.Stat(envFile); er == nil {
 		if er := parseEnvFile(envFile); er != nil {
 			panic(er)
@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"strings"
+	"syscall"
 	"time"
 
 	"golang.org/x/net/context"
@@ -24,6 +25,11 @@ var (
 	etcdTo     = 5 * time.Second
 	disableKey = "/chef.io/disable"
 	docker     string
+	runner     = process.NewRunner(func(p *process.Process) {
+		p.SetProcessGroup().KeepTail(20, 4096).ForwardSignals(syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	})
+
+	nodeNameFmt = "{role}-{env}-{instanceid}.aws.lumoslabs.com"
 
 	app           = kingpin.New("runchef", "A wrapper for chef in environments hostile to chef.")
 	logLevel      = app.Flag("log-level", "Log level.").Short('l').PlaceHolder("{debug,info,warn,error,fatal}").Default("info").Enum(logger.Levels...)
@@ -47,7 +53,7 @@ var (
 	client          = app.Command("client", "Execute a chef-client run.")
 	clientEnv       = client.Flag("environment", "Chef environment.").Short('e').Default("_default").Envar("CHEF_ENVIRONMENT").String()
 	clientRunlist   = client.Flag("runlist", "Chef runlist.").Short('r').Default(`''`).Envar("CHEF_RUNLIST").String()
-	clientName      = client.Flag("node-name", "Chef node name.").Short('n').Default(namefmt.GetName("{role}-{env}-{instanceid}.aws.lumoslabs.com")).String()
+	clientName      = client.Flag("node-name", "Chef node name. Default: "+nodeNameFmt).Short('n').String()
 	clientImage     = client.Flag("image", "Chef image to use").Short('i').Default("quay.io/lumoslabs/chef:latest").String()
 	clientContainer = client.Flag("container", "Chef container to use. Overrides image if set.").Short('c').String()
 	clientCache     = client.Flag("cache-name", "Chef cache container name.").Default("chef-cache").String()
@@ -135,26 +141,18 @@ func runShell(container, cache string, pull bool) error {
 		return er
 	}
 
-	var (
-		cmd = buildClientCmd(cache)
-		pa  = &os.ProcAttr{
-			Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
-			Dir:   cwd,
-		}
-	)
-
-	cmd = append(cmd, "-ti", container, "bash")
+	cmd := append(buildClientCmd(cache), "-ti", container, "bash")
 	logger.Debugf("CMD: %v", cmd)
 	if pull {
 		doPull(container)
 	}
 	createCache(cache)
-	p, er := os.StartProcess(cmd[0], cmd, pa)
+
+	p, er := process.NewArgv("shell", cmd)
 	if er != nil {
 		return er
 	}
-	_, er = p.Wait()
-	return er
+	return p.SetDir(cwd).Exec()
 }
 
 func cleanupChef() {
@@ -166,20 +164,15 @@ func run(name string, cmd []string, w ...io.Writer) error {
 	var c, q = context.WithTimeout(context.Background(), *timeout)
 	defer q()
 
-	p, er := process.New(name, strings.Join(cmd, " "), w...)
-	if er != nil {
-		return er
-	}
 	logger.Debugf("cmd: %s", cmd)
-	if er := p.Execute(c); er != nil {
-		return er
+	r, er := runner.Run(c, name, cmd, w...)
+	if r != nil {
+		logger.Debugf("%s finished: %v", name, r)
 	}
-	select {
-	case <-c.Done():
-		return fmt.Errorf("cmd %v timed out", p)
-	case <-p.Exited():
-		return p.Error()
+	if process.IsTimeout(er) {
+		return fmt.Errorf("cmd %s: %w", name, er)
 	}
+	return er
 }
 
 func doPull(image string) error {
@@ -211,6 +204,12 @@ func main() {
 	command := kingpin.MustParse(app.Parse(os.Args[1:]))
 	logger.Configure(*logLevel, "[runchef] ", os.Stdout)
 
+	d, er := exec.LookPath("docker")
+	if er != nil {
+		logger.Fatalf(er.Error())
+	}
+	docker = d
+
 	switch command {
 	case enable.FullCommand():
 		cli, er := ezd.New(etcdEp, etcdTo)
@@ -263,6 +262,9 @@ func main() {
 			logger.Infof("Chef is disabled: %v", reason)
 			os.Exit(0)
 		}
+		if len(*clientName) < 1 {
+			*clientName = namefmt.GetName(nodeNameFmt)
+		}
 		defer cleanupChef()
 		newClientRB(filepath.Join(*chefDir, "client.rb"), *clientName, *clientEnv, *sslVerify).write()
 		if er := runChef(c, *clientCache, *clientEnv, *clientRunlist, *clientForceFmt, *clientLocal, *pullImage); er != nil {
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/albertrdixon/gearbox/process/processtest"
+)
+
+func fakeRunner(cmdTimeout time.Duration) *processtest.Runner {
+	fake := processtest.New()
+	runner = fake
+	docker = "docker"
+	*timeout = cmdTimeout
+	return fake
+}
+
+func TestRunChef(t *testing.T) {
+	is := assert.New(t)
+	var tests = []struct {
+		run      int
+		cacheUp  bool
+		chefExit int
+		pull     bool
+		valid    bool
+		expected [][]string
+	}{
+		{1, true, 0, true, true, [][]string{
+			{"docker", "pull", "img"},
+			{"docker", "port", "chef-cache"},
+			{"docker", "rm", "-f", "chef"},
+		}},
+		{2, false, 0, false, true, [][]string{
+			{"docker", "port", "chef-cache"},
+			{"docker", "create", "--name=chef-cache", "--volume=/chef", "busybox"},
+			{"docker", "rm", "-f", "chef"},
+		}},
+		{3, true, 1, false, false, [][]string{
+			{"docker", "port", "chef-cache"},
+			{"docker", "rm", "-f", "chef"},
+		}},
+	}
+
+	for _, test := range tests {
+		fake := fakeRunner(time.Second)
+		if !test.cacheUp {
+			fake.On([]string{"docker", "port"}, processtest.Response{ExitCode: 1})
+		}
+		fake.On([]string{"docker", "run"}, processtest.Response{ExitCode: test.chefExit})
+
+		er := runChef("img", "chef-cache", "prod", "role[a], recipe[b]", true, false, test.pull)
+		is.Equal(test.valid, er == nil, "test %d: %v", test.run, er)
+
+		argvs := fake.Argvs()
+		if !is.Len(argvs, len(test.expected)+1, "test %d", test.run) {
+			continue
+		}
+		is.Equal(test.expected, argvs[:len(test.expected)], "test %d", test.run)
+
+		chef := argvs[len(argvs)-1]
+		is.Equal([]string{"docker", "run"}, chef[:2], "test %d", test.run)
+		is.Contains(chef, "--volumes-from=chef-cache", "test %d", test.run)
+		is.Contains(chef, "--environment=prod", "test %d", test.run)
+		is.Contains(chef, "--runlist=role[a], recipe[b]", "test %d", test.run)
+		is.Equal("--force-formatter", chef[len(chef)-1], "test %d", test.run)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	is := assert.New(t)
+	fake := fakeRunner(10 * time.Millisecond)
+	fake.On([]string{"docker", "pull"}, processtest.Response{Delay: time.Minute})
+
+	er := doPull("img")
+	if is.Error(er) {
+		is.Contains(er.Error(), "timed out")
+	}
+}
+
+func TestCleanupChef(t *testing.T) {
+	is := assert.New(t)
+	fake := fakeRunner(time.Second)
+	fake.Default = processtest.Response{ExitCode: 1}
+
+	cleanupChef()
+	is.Equal([][]string{
+		{"docker", "kill", "chef"},
+		{"docker", "rm", "-f", "chef"},
+	}, fake.Argvs())
+}